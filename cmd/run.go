@@ -47,6 +47,10 @@ const (
 	// idleTimeout is the maximum amount of time to wait for the
 	// next request when keep-alives are enabled.
 	idleTimeout = 30 * time.Second
+
+	// cacheStatsInterval is the delay between two logs of
+	// the block cache statistics.
+	cacheStatsInterval = time.Minute
 )
 
 var (
@@ -82,7 +86,57 @@ func runRunCmd(cmd *cobra.Command, args []string) error {
 
 	g, ctx := errgroup.WithContext(ctx)
 
-	client := icon.NewClient(cfg.URL, client_v1.ICXCurrency)
+	client := icon.NewClient(cfg.URLs, client_v1.ICXCurrency)
+	client.SetRetryPolicy(client_v1.NewRetryPolicy(cfg.RetryAttempts, cfg.RetryBackoff))
+	client.Pool().Interval = cfg.HealthCheckInterval
+	client.Pool().MaxBlockLag = cfg.MaxBlockLag
+	client.SetBlockCacheSize(cfg.BlockCacheSize)
+	client.SetPrefetch(cfg.PrefetchDepth, cfg.PrefetchWorkers)
+	client.SetReceiptWorkers(cfg.ReceiptWorkers)
+	client.SetPeerTTL(cfg.PeerTTL)
+	switch cfg.FixtureMode {
+	case configuration.Record:
+		client.SetTransport(client_v1.NewRecordTransport(cfg.FixtureDir))
+	case configuration.Replay:
+		client.SetTransport(client_v1.NewReplayTransport(cfg.FixtureDir))
+	}
+	switch {
+	case len(cfg.TokenRegistry) > 0:
+		tokens, err := client_v1.LoadTokenRegistry(cfg.TokenRegistry, cfg.TokenResolve)
+		if err != nil {
+			return err
+		}
+		client.SetTokenRegistry(tokens)
+	case cfg.TokenResolve:
+		client.SetTokenRegistry(client_v1.NewTokenRegistry(true))
+	}
+	if cfg.Mode == configuration.Online {
+		missing, unknown, err := client.DetectCapabilities(ctx)
+		if err != nil {
+			log.Printf("unable to detect node capabilities: %v", err)
+		} else {
+			for _, err := range unknown {
+				log.Printf("%v: the debug API is assumed to be exposed", err)
+			}
+		}
+		for _, endpoint := range missing {
+			log.Printf("%s does not expose the debug API: balances are read with icx_getBalance and getStake, and steps can not be estimated", endpoint)
+		}
+	}
+	if cfg.Mode == configuration.Online && len(cfg.DataDir) > 0 {
+		store, err := icon.OpenStore(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		client.SetStore(store)
+
+		g.Go(func() error {
+			client.Follow(ctx, store, cfg.StoreStartHeight, icon.DefaultFollowInterval)
+			return nil
+		})
+	}
+
 	router := services.NewBlockchainRouter(cfg, client, asserter)
 
 	loggedRouter := server.LoggerMiddleware(router)
@@ -95,6 +149,28 @@ func runRunCmd(cmd *cobra.Command, args []string) error {
 		IdleTimeout:  idleTimeout,
 	}
 
+	if cfg.Mode == configuration.Online {
+		g.Go(func() error {
+			client.MonitorNodes(ctx)
+			return nil
+		})
+
+		if cfg.BlockCacheSize > 0 {
+			g.Go(func() error {
+				ticker := time.NewTicker(cacheStatsInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return nil
+					case <-ticker.C:
+						log.Printf("block cache: %s", client.BlockCacheStats())
+					}
+				}
+			})
+		}
+	}
+
 	g.Go(func() error {
 		log.Printf("server listening on port %d", cfg.Port)
 		return server.ListenAndServe()
@@ -18,10 +18,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/leeheonseung/rosetta-icon/icon"
 	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Mode is the setting that determines if
@@ -56,7 +58,9 @@ const (
 	NetworkEnv = "NETWORK"
 
 	// EndpointEnv is the environment variable
-	// read to determine endpoint.
+	// read to determine endpoint. Several endpoints
+	// can be given separated by commas, the first one
+	// being the primary node.
 	EndpointEnv = "ENDPOINT"
 
 	// DefaultEndPoint is the default endpoint for a running node.
@@ -70,15 +74,119 @@ const (
 	// read to determine the port for the Rosetta
 	// implementation.
 	PortEnv = "PORT"
+
+	// RetryAttemptsEnv is the environment variable
+	// read to determine how many times a node request
+	// is attempted before giving up.
+	RetryAttemptsEnv = "RETRY_ATTEMPTS"
+
+	// RetryBackoffEnv is the environment variable
+	// read to determine the delay before the first
+	// retry of a node request (ex. 200ms).
+	RetryBackoffEnv = "RETRY_BACKOFF"
+
+	// HealthCheckIntervalEnv is the environment variable
+	// read to determine how often the nodes are health
+	// checked (ex. 10s).
+	HealthCheckIntervalEnv = "HEALTH_CHECK_INTERVAL"
+
+	// MaxBlockLagEnv is the environment variable read
+	// to determine how many blocks a node may fall behind
+	// before reads avoid it.
+	MaxBlockLagEnv = "MAX_BLOCK_LAG"
+
+	// BlockCacheSizeEnv is the environment variable
+	// read to determine how many bytes of parsed blocks
+	// are cached. 0 disables the cache.
+	BlockCacheSizeEnv = "BLOCK_CACHE_SIZE"
+
+	// PrefetchDepthEnv is the environment variable
+	// read to determine how many blocks are fetched
+	// ahead of a sequential reader. 0 disables prefetching.
+	PrefetchDepthEnv = "PREFETCH_DEPTH"
+
+	// PrefetchWorkersEnv is the environment variable
+	// read to determine how many blocks are prefetched
+	// concurrently.
+	PrefetchWorkersEnv = "PREFETCH_WORKERS"
+
+	// ReceiptWorkersEnv is the environment variable
+	// read to determine how many transaction results
+	// are requested concurrently from nodes which do
+	// not serve block receipts.
+	ReceiptWorkersEnv = "RECEIPT_WORKERS"
+
+	// PeerTTLEnv is the environment variable read to
+	// determine how long the P-Rep list of /network/status
+	// is served from memory (ex. 1m).
+	PeerTTLEnv = "PEER_TTL"
+
+	// DataDirEnv is the environment variable read to
+	// determine where blocks are stored on disk. Blocks
+	// are only stored when it is set.
+	DataDirEnv = "DATA_DIR"
+
+	// StoreStartHeightEnv is the environment variable
+	// read to determine the first block stored in an
+	// empty store. The current head is used by default.
+	StoreStartHeightEnv = "STORE_START_HEIGHT"
+
+	// TokenRegistryEnv is the environment variable read
+	// to determine the JSON file listing the IRC2 tokens
+	// whose transfers are parsed into operations.
+	TokenRegistryEnv = "TOKEN_REGISTRY"
+
+	// TokenResolveEnv is the environment variable read
+	// to determine whether IRC2 tokens missing from the
+	// registry are looked up on the node.
+	TokenResolveEnv = "TOKEN_RESOLVE"
+
+	// FixtureModeEnv is the environment variable read
+	// to determine whether node requests are recorded
+	// to or replayed from fixture files.
+	FixtureModeEnv = "FIXTURE_MODE"
+
+	// FixtureDirEnv is the environment variable read
+	// to determine where fixture files are stored.
+	FixtureDirEnv = "FIXTURE_DIR"
+
+	// Record stores every node request and response
+	// as a fixture.
+	Record FixtureMode = "RECORD"
+
+	// Replay answers node requests from fixtures,
+	// without connecting to a node.
+	Replay FixtureMode = "REPLAY"
 )
 
+// FixtureMode is the setting that determines if node
+// requests are recorded or replayed.
+type FixtureMode string
+
 // Configuration determines how
 type Configuration struct {
-	Mode     Mode
-	Network  *types.NetworkIdentifier
-	URL      string
-	DebugURL string
-	Port     int
+	Mode                Mode
+	Network             *types.NetworkIdentifier
+	URL                 string
+	DebugURL            string
+	URLs                []string
+	DebugURLs           []string
+	Port                int
+	RetryAttempts       int
+	RetryBackoff        time.Duration
+	HealthCheckInterval time.Duration
+	MaxBlockLag         int64
+	BlockCacheSize      int64
+	PrefetchDepth       int
+	PrefetchWorkers     int
+	ReceiptWorkers      int
+	PeerTTL             time.Duration
+	DataDir             string
+	StoreStartHeight    int64
+	TokenRegistry       string
+	TokenResolve        bool
+	FixtureMode         FixtureMode
+	FixtureDir          string
 }
 
 // LoadConfiguration attempts to create a new Configuration
@@ -127,37 +235,37 @@ func LoadConfiguration() (*Configuration, error) {
 	}
 
 	envEndpoint := os.Getenv(EndpointEnv)
+	endpoints := []string{DefaultEndPoint}
 	if len(envEndpoint) > 0 {
-		url := []string{
-			envEndpoint,
-			EndpointPrefix,
-			EndpointVersionPrefix,
+		endpoints = nil
+		for _, endpoint := range strings.Split(envEndpoint, ",") {
+			if endpoint = strings.TrimSpace(endpoint); len(endpoint) > 0 {
+				endpoints = append(endpoints, endpoint)
+			}
 		}
-		config.URL = strings.Join(url, "/")
-
-		debugUrl := []string{
-			envEndpoint,
-			EndpointPrefix,
-			DebugPrefix,
-			EndpointVersionPrefix,
+		if len(endpoints) == 0 {
+			return nil, fmt.Errorf("%s is not a valid endpoint list", envEndpoint)
 		}
-		config.DebugURL = strings.Join(debugUrl, "/")
-	} else {
+	}
+
+	for _, endpoint := range endpoints {
 		url := []string{
-			DefaultEndPoint,
+			endpoint,
 			EndpointPrefix,
 			EndpointVersionPrefix,
 		}
-		config.URL = strings.Join(url, "/")
+		config.URLs = append(config.URLs, strings.Join(url, "/"))
 
 		debugUrl := []string{
-			DefaultEndPoint,
+			endpoint,
 			EndpointPrefix,
 			DebugPrefix,
 			EndpointVersionPrefix,
 		}
-		config.DebugURL = strings.Join(debugUrl, "/")
+		config.DebugURLs = append(config.DebugURLs, strings.Join(debugUrl, "/"))
 	}
+	config.URL = config.URLs[0]
+	config.DebugURL = config.DebugURLs[0]
 
 	envPort := os.Getenv(PortEnv)
 	if len(envPort) == 0 {
@@ -170,5 +278,148 @@ func LoadConfiguration() (*Configuration, error) {
 	}
 	config.Port = port
 
+	config.RetryAttempts = client_v1.DefaultRetryAttempts
+	if envRetry := os.Getenv(RetryAttemptsEnv); len(envRetry) > 0 {
+		attempts, err := strconv.Atoi(envRetry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse retry attempts %s", err, envRetry)
+		}
+		if attempts <= 0 {
+			return nil, fmt.Errorf("retry attempts %s must be positive", envRetry)
+		}
+		config.RetryAttempts = attempts
+	}
+
+	config.RetryBackoff = client_v1.DefaultRetryBackoff
+	if envBackoff := os.Getenv(RetryBackoffEnv); len(envBackoff) > 0 {
+		backoff, err := time.ParseDuration(envBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse retry backoff %s", err, envBackoff)
+		}
+		if backoff < 0 {
+			return nil, fmt.Errorf("retry backoff %s must not be negative", envBackoff)
+		}
+		config.RetryBackoff = backoff
+	}
+
+	config.HealthCheckInterval = icon.DefaultHealthCheckInterval
+	if envInterval := os.Getenv(HealthCheckIntervalEnv); len(envInterval) > 0 {
+		interval, err := time.ParseDuration(envInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse health check interval %s", err, envInterval)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("health check interval %s must be positive", envInterval)
+		}
+		config.HealthCheckInterval = interval
+	}
+
+	config.MaxBlockLag = icon.DefaultMaxBlockLag
+	if envLag := os.Getenv(MaxBlockLagEnv); len(envLag) > 0 {
+		lag, err := strconv.ParseInt(envLag, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse max block lag %s", err, envLag)
+		}
+		if lag < 0 {
+			return nil, fmt.Errorf("max block lag %s must not be negative", envLag)
+		}
+		config.MaxBlockLag = lag
+	}
+
+	config.BlockCacheSize = icon.DefaultBlockCacheSize
+	if envCacheSize := os.Getenv(BlockCacheSizeEnv); len(envCacheSize) > 0 {
+		size, err := strconv.ParseInt(envCacheSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse block cache size %s", err, envCacheSize)
+		}
+		if size < 0 {
+			return nil, fmt.Errorf("block cache size %s must not be negative", envCacheSize)
+		}
+		config.BlockCacheSize = size
+	}
+
+	config.PrefetchDepth = icon.DefaultPrefetchDepth
+	if envDepth := os.Getenv(PrefetchDepthEnv); len(envDepth) > 0 {
+		depth, err := strconv.Atoi(envDepth)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse prefetch depth %s", err, envDepth)
+		}
+		if depth < 0 {
+			return nil, fmt.Errorf("prefetch depth %s must not be negative", envDepth)
+		}
+		config.PrefetchDepth = depth
+	}
+
+	config.PrefetchWorkers = icon.DefaultPrefetchWorkers
+	if envWorkers := os.Getenv(PrefetchWorkersEnv); len(envWorkers) > 0 {
+		workers, err := strconv.Atoi(envWorkers)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse prefetch workers %s", err, envWorkers)
+		}
+		if workers <= 0 {
+			return nil, fmt.Errorf("prefetch workers %s must be positive", envWorkers)
+		}
+		config.PrefetchWorkers = workers
+	}
+
+	config.ReceiptWorkers = client_v1.DefaultReceiptWorkers
+	if envWorkers := os.Getenv(ReceiptWorkersEnv); len(envWorkers) > 0 {
+		workers, err := strconv.Atoi(envWorkers)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse receipt workers %s", err, envWorkers)
+		}
+		if workers <= 0 {
+			return nil, fmt.Errorf("receipt workers %s must be positive", envWorkers)
+		}
+		config.ReceiptWorkers = workers
+	}
+
+	config.PeerTTL = icon.DefaultPeerTTL
+	if envTTL := os.Getenv(PeerTTLEnv); len(envTTL) > 0 {
+		ttl, err := time.ParseDuration(envTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse peer ttl %s", err, envTTL)
+		}
+		if ttl < 0 {
+			return nil, fmt.Errorf("peer ttl %s must not be negative", envTTL)
+		}
+		config.PeerTTL = ttl
+	}
+
+	config.DataDir = os.Getenv(DataDirEnv)
+	config.StoreStartHeight = -1
+	if envStart := os.Getenv(StoreStartHeightEnv); len(envStart) > 0 {
+		start, err := strconv.ParseInt(envStart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse store start height %s", err, envStart)
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("store start height %s must not be negative", envStart)
+		}
+		config.StoreStartHeight = start
+	}
+
+	config.TokenRegistry = os.Getenv(TokenRegistryEnv)
+	if envResolve := os.Getenv(TokenResolveEnv); len(envResolve) > 0 {
+		resolve, err := strconv.ParseBool(envResolve)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse token resolve %s", err, envResolve)
+		}
+		config.TokenResolve = resolve
+	}
+
+	fixtureMode := FixtureMode(os.Getenv(FixtureModeEnv))
+	switch fixtureMode {
+	case Record, Replay:
+		config.FixtureMode = fixtureMode
+		config.FixtureDir = os.Getenv(FixtureDirEnv)
+		if len(config.FixtureDir) == 0 {
+			return nil, errors.New("FIXTURE_DIR must be populated")
+		}
+	case "":
+	default:
+		return nil, fmt.Errorf("%s is not a valid fixture mode", fixtureMode)
+	}
+
 	return config, nil
 }
@@ -7,5 +7,6 @@ require (
 	github.com/fatih/color v1.9.0
 	github.com/icon-project/goloop v0.9.3
 	github.com/spf13/cobra v0.0.5
+	github.com/syndtr/goleveldb v1.0.1-0.20200815110645-5c35d600f0ca
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
 )
@@ -0,0 +1,247 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+)
+
+// DefaultBlockCacheSize is the default number of bytes of parsed
+// blocks kept in a BlockCache.
+const DefaultBlockCacheSize = int64(64 << 20)
+
+// CacheStats are the counters of a BlockCache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Size      int64
+	MaxSize   int64
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf(
+		"hits=%d misses=%d evictions=%d entries=%d size=%d/%d",
+		s.Hits, s.Misses, s.Evictions, s.Entries, s.Size, s.MaxSize,
+	)
+}
+
+type cacheEntry struct {
+	id      *RosettaTypes.BlockIdentifier
+	encoded []byte
+}
+
+// BlockCache keeps parsed blocks, which are final once produced on ICON,
+// so that they can be looked up by height or by hash without a node
+// request. The least recently used blocks are evicted once the encoded
+// size of the cached blocks exceeds the maximum size.
+//
+// Blocks are kept encoded, so every lookup returns a copy of its own,
+// which the caller may modify without affecting the cache or any other
+// caller.
+type BlockCache struct {
+	mtx      sync.Mutex
+	maxSize  int64
+	size     int64
+	lru      *list.List
+	byHeight map[int64]*list.Element
+	byHash   map[string]*list.Element
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewBlockCache creates a cache holding up to maxSize bytes of blocks.
+// A maxSize of 0 disables caching.
+func NewBlockCache(maxSize int64) *BlockCache {
+	return &BlockCache{
+		maxSize:  maxSize,
+		lru:      list.New(),
+		byHeight: map[int64]*list.Element{},
+		byHash:   map[string]*list.Element{},
+	}
+}
+
+// Get returns the cached block matching id. A block is only returned when
+// both the index and the hash of id, if set, match it. Requests for the
+// latest block are never served from the cache.
+func (c *BlockCache) Get(id *RosettaTypes.PartialBlockIdentifier) (*RosettaTypes.Block, bool) {
+	if id == nil || (id.Index == nil && id.Hash == nil) {
+		return nil, false
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e := c.lookup(id)
+	if e == nil {
+		c.misses++
+		return nil, false
+	}
+	block, err := decodeCachedBlock(e.Value.(*cacheEntry).encoded)
+	if err != nil {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return block, true
+}
+
+// Transaction returns the transaction with the given hash from the cached
+// block matching id.
+func (c *BlockCache) Transaction(
+	id *RosettaTypes.PartialBlockIdentifier,
+	hash string,
+) (*RosettaTypes.Transaction, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e := c.lookup(id); e != nil {
+		block, err := decodeCachedBlock(e.Value.(*cacheEntry).encoded)
+		if err != nil {
+			c.misses++
+			return nil, false
+		}
+		for _, tx := range block.Transactions {
+			if client_v1.NormalizeHash(tx.TransactionIdentifier.Hash) == client_v1.NormalizeHash(hash) {
+				c.hits++
+				c.lru.MoveToFront(e)
+				return tx, true
+			}
+		}
+	}
+	c.misses++
+	return nil, false
+}
+
+// Identifier returns the identifier of the cached block matching id,
+// without decoding the block.
+func (c *BlockCache) Identifier(id *RosettaTypes.PartialBlockIdentifier) (*RosettaTypes.BlockIdentifier, bool) {
+	if id == nil || (id.Index == nil && id.Hash == nil) {
+		return nil, false
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e := c.lookup(id)
+	if e == nil {
+		return nil, false
+	}
+	found := e.Value.(*cacheEntry).id
+	return &RosettaTypes.BlockIdentifier{Index: found.Index, Hash: found.Hash}, true
+}
+
+// Has reports whether the block at height is cached, without counting
+// as a hit or a miss.
+func (c *BlockCache) Has(height int64) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	_, ok := c.byHeight[height]
+	return ok
+}
+
+func (c *BlockCache) lookup(id *RosettaTypes.PartialBlockIdentifier) *list.Element {
+	var e *list.Element
+	switch {
+	case id.Index != nil:
+		e = c.byHeight[*id.Index]
+	case id.Hash != nil:
+		e = c.byHash[client_v1.NormalizeHash(*id.Hash)]
+	}
+	if e == nil {
+		return nil
+	}
+	if id.Hash != nil && client_v1.NormalizeHash(e.Value.(*cacheEntry).id.Hash) != client_v1.NormalizeHash(*id.Hash) {
+		return nil
+	}
+	return e
+}
+
+// Add stores a copy of block. Blocks larger than the cache itself are
+// not stored.
+func (c *BlockCache) Add(block *RosettaTypes.Block) {
+	if c.maxSize <= 0 || block == nil || block.BlockIdentifier == nil {
+		return
+	}
+	b, err := json.Marshal(block)
+	if err != nil {
+		return
+	}
+	size := int64(len(b))
+	if size > c.maxSize {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e, ok := c.byHeight[block.BlockIdentifier.Index]; ok {
+		c.remove(e)
+	}
+	id := &RosettaTypes.BlockIdentifier{
+		Index: block.BlockIdentifier.Index,
+		Hash:  block.BlockIdentifier.Hash,
+	}
+	e := c.lru.PushFront(&cacheEntry{id: id, encoded: b})
+	c.byHeight[block.BlockIdentifier.Index] = e
+	c.byHash[client_v1.NormalizeHash(block.BlockIdentifier.Hash)] = e
+	c.size += size
+
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *BlockCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.byHeight, entry.id.Index)
+	delete(c.byHash, client_v1.NormalizeHash(entry.id.Hash))
+	c.size -= int64(len(entry.encoded))
+}
+
+func decodeCachedBlock(b []byte) (*RosettaTypes.Block, error) {
+	block := new(RosettaTypes.Block)
+	if err := json.Unmarshal(b, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// Stats returns the current counters of the cache.
+func (c *BlockCache) Stats() CacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   c.lru.Len(),
+		Size:      c.size,
+		MaxSize:   c.maxSize,
+	}
+}
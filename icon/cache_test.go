@@ -0,0 +1,98 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"testing"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func cacheTestBlock() *RosettaTypes.Block {
+	return &RosettaTypes.Block{
+		BlockIdentifier:       &RosettaTypes.BlockIdentifier{Index: 7, Hash: "0xab"},
+		ParentBlockIdentifier: &RosettaTypes.BlockIdentifier{Index: 6, Hash: "0xaa"},
+		Transactions: []*RosettaTypes.Transaction{{
+			TransactionIdentifier: &RosettaTypes.TransactionIdentifier{Hash: "0x01"},
+			Operations: []*RosettaTypes.Operation{{
+				OperationIdentifier: &RosettaTypes.OperationIdentifier{Index: 0},
+				Type:                "TRANSFER",
+				Account:             &RosettaTypes.AccountIdentifier{Address: "hx01"},
+			}},
+			Metadata: map[string]interface{}{"status": "SUCCESS"},
+		}},
+	}
+}
+
+func TestBlockCacheReturnsCopies(t *testing.T) {
+	c := NewBlockCache(DefaultBlockCacheSize)
+	added := cacheTestBlock()
+	c.Add(added)
+
+	// Changes to the added block do not reach the cache.
+	added.Transactions[0].Operations[0].Account.Address = "hx02"
+
+	index := int64(7)
+	id := &RosettaTypes.PartialBlockIdentifier{Index: &index}
+	first, ok := c.Get(id)
+	if !ok {
+		t.Fatal("block not cached")
+	}
+	if first.Transactions[0].Operations[0].Account.Address != "hx01" {
+		t.Fatalf("cached block changed with the added one")
+	}
+
+	// Changes to a returned block do not reach the cache.
+	first.Transactions[0].Metadata["status"] = "FAILURE"
+	first.Transactions = nil
+
+	second, ok := c.Get(id)
+	if !ok || len(second.Transactions) != 1 || second.Transactions[0].Metadata["status"] != "SUCCESS" {
+		t.Fatalf("cached block changed with a returned one: %s", RosettaTypes.PrettyPrintStruct(second))
+	}
+
+	tx, ok := c.Transaction(id, "01")
+	if !ok {
+		t.Fatal("transaction not cached")
+	}
+	tx.Operations = nil
+	if tx, _ := c.Transaction(id, "0x01"); len(tx.Operations) != 1 {
+		t.Fatalf("cached transaction changed with a returned one")
+	}
+}
+
+func TestBlockCacheEvictsBySize(t *testing.T) {
+	block := cacheTestBlock()
+	c := NewBlockCache(1)
+	c.Add(block)
+	if c.Has(7) {
+		t.Fatal("block larger than the cache was stored")
+	}
+
+	c = NewBlockCache(DefaultBlockCacheSize)
+	c.Add(block)
+	size := c.Stats().Size
+	c = NewBlockCache(size)
+	c.Add(block)
+	next := cacheTestBlock()
+	next.BlockIdentifier = &RosettaTypes.BlockIdentifier{Index: 8, Hash: "0xac"}
+	c.Add(next)
+	if c.Has(7) || !c.Has(8) {
+		t.Fatal("least recently used block not evicted")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 1 || stats.Size > stats.MaxSize {
+		t.Fatalf("stats %s", stats)
+	}
+}
@@ -15,10 +15,13 @@
 package icon
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/icon-project/goloop/common"
 	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"net/http"
 )
 
 // Client is used to fetch blocks from ICON Node and
@@ -30,54 +33,287 @@ import (
 
 type Client struct {
 	currency *RosettaTypes.Currency
-	iconV1   *client_v1.ClientV3
+	pool     *NodePool
+	cache    *BlockCache
+	prefetch *prefetcher
+	status   *statusCache
+	store    *Store
 }
 
+// NewClient creates a Client for one or more ICON nodes. The first
+// endpoint is the primary node transactions are submitted to.
 func NewClient(
-	endpoint string,
+	endpoints []string,
 	currency *RosettaTypes.Currency,
 ) *Client {
 	return &Client{
 		currency,
-		client_v1.NewClientV3(endpoint),
+		NewNodePool(endpoints),
+		NewBlockCache(DefaultBlockCacheSize),
+		newPrefetcher(DefaultPrefetchDepth, DefaultPrefetchWorkers),
+		newStatusCache(DefaultPeerTTL),
+		nil,
 	}
 }
 
-func (ic *Client) GetBlock(params *RosettaTypes.PartialBlockIdentifier) (*RosettaTypes.Block, error) {
+// SetRetryPolicy replaces the retry policy used for node requests.
+func (ic *Client) SetRetryPolicy(policy *client_v1.RetryPolicy) {
+	for _, c := range ic.pool.Clients() {
+		c.Retry = policy
+	}
+}
 
-	//이렇게 하는 방법밖에 없는가?
-	var reqParams *client_v1.BlockRPCRequest
+// SetTransport replaces the transport used for node requests.
+func (ic *Client) SetTransport(rt http.RoundTripper) {
+	for _, c := range ic.pool.Clients() {
+		c.SetTransport(rt)
+	}
+}
+
+// SetTokenRegistry sets the IRC2 tokens whose transfers are parsed into
+// operations.
+func (ic *Client) SetTokenRegistry(tokens *client_v1.TokenRegistry) {
+	for _, c := range ic.pool.Clients() {
+		c.Tokens = tokens
+	}
+}
+
+// SetBlockCacheSize replaces the block cache by an empty one holding up
+// to size bytes of blocks. A size of 0 disables caching.
+func (ic *Client) SetBlockCacheSize(size int64) {
+	ic.cache = NewBlockCache(size)
+}
+
+// SetPrefetch sets how many blocks are fetched ahead of a reader walking
+// the blocks in ascending height order, and how many of them are fetched
+// concurrently. Prefetched blocks are kept in the block cache, so a depth
+// of 0 or a disabled cache disables prefetching.
+func (ic *Client) SetPrefetch(depth int, workers int) {
+	ic.prefetch = newPrefetcher(depth, workers)
+}
+
+// BlockCacheStats returns the counters of the block cache.
+func (ic *Client) BlockCacheStats() CacheStats {
+	return ic.cache.Stats()
+}
+
+// Pool returns the nodes the client sends requests to.
+func (ic *Client) Pool() *NodePool {
+	return ic.pool
+}
+
+// SetReceiptWorkers sets how many transaction results are requested
+// concurrently from nodes which do not serve block receipts.
+func (ic *Client) SetReceiptWorkers(workers int) {
+	for _, c := range ic.pool.Clients() {
+		c.ReceiptWorkers = workers
+	}
+}
+
+// DetectCapabilities checks which nodes expose the debug API, and
+// returns the endpoints of those which do not. Balances are read without
+// the debug API from those nodes, and steps are estimated on the others.
+//
+// Nodes which can not be probed are skipped, and the reasons are returned
+// in unknown. They are assumed to expose the debug API until a request
+// shows otherwise. An error is only returned when no node could be probed.
+func (ic *Client) DetectCapabilities(ctx context.Context) (missing []string, unknown []error, err error) {
+	clients := ic.pool.Clients()
+	for _, c := range clients {
+		if err := c.DetectCapabilities(ctx); err != nil {
+			unknown = append(unknown, fmt.Errorf("%w: could not detect capabilities of %s", err, c.Endpoint))
+			continue
+		}
+		if !c.HasDebug() {
+			missing = append(missing, c.Endpoint)
+		}
+	}
+	if len(clients) > 0 && len(unknown) == len(clients) {
+		return nil, unknown, fmt.Errorf("%w: no node could be probed", unknown[0])
+	}
+	return missing, unknown, nil
+}
+
+func (ic *Client) MonitorNodes(ctx context.Context) {
+	ic.pool.Monitor(ctx)
+}
+
+func (ic *Client) GetBlock(ctx context.Context, params *RosettaTypes.PartialBlockIdentifier) (*RosettaTypes.Block, error) {
+	if ic.store != nil {
+		if block, err := ic.store.Block(params); block != nil && err == nil {
+			return block, nil
+		}
+	}
+
+	// Blocks read from the store are not prefetched, as the following
+	// ones are most likely stored as well.
+	if params.Index != nil && ic.cache.maxSize > 0 {
+		defer ic.prefetch.observe(ic, *params.Index, ic.pool.Height())
+	}
+	if block, ok := ic.cache.Get(params); ok {
+		return block, nil
+	}
+	if params.Index != nil && params.Hash == nil {
+		if block, ok := ic.prefetch.wait(ctx, *params.Index); ok {
+			return block, nil
+		}
+	}
+
+	block, err := ic.fetchBlock(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	ic.cache.Add(block)
+	return block, nil
+}
+
+func (ic *Client) fetchBlock(ctx context.Context, params *RosettaTypes.PartialBlockIdentifier) (*RosettaTypes.Block, error) {
+	reqParams := blockRequest(params)
+
+	var block *RosettaTypes.Block
+	err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		var trsArray []*client_v1.TransactionResult
+		var err error
 
-	if params.Index == nil && params.Hash == nil {
-		reqParams = &client_v1.BlockRPCRequest{}
-		//return nil, errors.New("Invalid Both value")
+		// The latest block has to be resolved first, so that its receipts
+		// can be requested by hash.
+		if reqParams.Height == "" && reqParams.Hash == "" {
+			block, err = c.GetBlock(ctx, reqParams)
+			if err != nil {
+				return fmt.Errorf("%w: could not get block", err)
+			}
+
+			trsArray, err = c.GetReceipts(ctx, block)
+			if err != nil {
+				return fmt.Errorf("%w: could not get blockReceipts", err)
+			}
+		} else {
+			block, trsArray, err = c.GetBlockWithReceipts(ctx, reqParams)
+			if err != nil {
+				return fmt.Errorf("%w: could not get block", err)
+			}
+		}
+		if err = c.ResolveTokens(ctx, trsArray); err != nil {
+			return fmt.Errorf("%w: could not resolve tokens", err)
+		}
+		block, err = c.MakeBlockWithReceipts(block, trsArray)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return block, nil
+}
 
+// blockRequest returns the icx_getBlock params for params, which ask for
+// the latest block when params is empty.
+func blockRequest(params *RosettaTypes.PartialBlockIdentifier) *client_v1.BlockRPCRequest {
+	//이렇게 하는 방법밖에 없는가?
 	if params.Index != nil {
-		reqParams = &client_v1.BlockRPCRequest{
+		return &client_v1.BlockRPCRequest{
 			Height: common.HexInt64{Value: *params.Index}.String(),
 		}
 	} else if params.Hash != nil {
-		reqParams = &client_v1.BlockRPCRequest{
+		return &client_v1.BlockRPCRequest{
 			Hash: *params.Hash,
 		}
 	}
+	return &client_v1.BlockRPCRequest{}
+}
+
+// ErrBlockNotFound is returned when the block a request refers to is not
+// known to the node, or is beyond its latest block.
+var ErrBlockNotFound = errors.New("block not found")
+
+// resolveBlock returns the identifier of the block matching params. It is
+// looked up in the store and the block cache, and otherwise read from the
+// header of the block on a node, without fetching the receipts of the
+// block or prefetching the blocks after it.
+func (ic *Client) resolveBlock(
+	ctx context.Context,
+	params *RosettaTypes.PartialBlockIdentifier,
+) (*RosettaTypes.BlockIdentifier, error) {
+	if ic.store != nil {
+		if block, err := ic.store.Block(params); block != nil && err == nil {
+			return block.BlockIdentifier, nil
+		}
+	}
+	if id, ok := ic.cache.Identifier(params); ok {
+		return id, nil
+	}
 
-	block, err := ic.iconV1.GetBlock(reqParams)
+	var header *client_v1.BlockHeader
+	err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		var err error
+		header, err = c.GetBlockHeader(ctx, blockRequest(params))
+		return err
+	})
+	if errors.Is(err, client_v1.ErrNotFound) || errors.Is(err, client_v1.ErrInvalidParams) {
+		return nil, fmt.Errorf("%w: %v", ErrBlockNotFound, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get block", err)
+		return nil, err
 	}
+	id := header.Identifier()
+	if params.Hash != nil && client_v1.NormalizeHash(id.Hash) != client_v1.NormalizeHash(*params.Hash) {
+		return nil, fmt.Errorf("%w: block %d has hash %s, not %s", ErrBlockNotFound, id.Index, id.Hash, *params.Hash)
+	}
+	return id, nil
+}
 
-	reqParams = &client_v1.BlockRPCRequest{Hash: block.BlockIdentifier.Hash}
-	trsArray, err := ic.iconV1.GetBlockReceipts(reqParams)
+// GetBlockTransaction returns a transaction of the given block, from the
+// store or the block cache when the block is kept there.
+func (ic *Client) GetBlockTransaction(
+	ctx context.Context,
+	block *RosettaTypes.BlockIdentifier,
+	params *RosettaTypes.TransactionIdentifier,
+) (*RosettaTypes.Transaction, error) {
+	id := &RosettaTypes.PartialBlockIdentifier{
+		Index: &block.Index,
+		Hash:  &block.Hash,
+	}
+	if ic.store != nil {
+		if tx, found, err := ic.store.Transaction(params.Hash); tx != nil && err == nil {
+			return tx, inBlock(params, block, found)
+		}
+	}
+	if tx, ok := ic.cache.Transaction(id, params.Hash); ok {
+		return tx, nil
+	}
+	tx, found, err := ic.getTransaction(ctx, params)
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get blockReceipts", err)
+		return nil, err
 	}
-	ic.iconV1.MakeBlockWithReceipts(block, trsArray)
-	return block, nil
+	return tx, inBlock(params, block, found)
+}
+
+// ErrWrongBlock is returned when a transaction is not part of the block
+// it is requested from.
+var ErrWrongBlock = errors.New("transaction is not in the block")
+
+// inBlock checks that the transaction tx, found in the block found, is
+// part of block.
+func inBlock(tx *RosettaTypes.TransactionIdentifier, block *RosettaTypes.BlockIdentifier, found *RosettaTypes.BlockIdentifier) error {
+	if found == nil {
+		return fmt.Errorf("%w: block of %s unknown", ErrWrongBlock, tx.Hash)
+	}
+	if found.Index != block.Index || client_v1.NormalizeHash(found.Hash) != client_v1.NormalizeHash(block.Hash) {
+		return fmt.Errorf("%w: %s is in block %d %s", ErrWrongBlock, tx.Hash, found.Index, found.Hash)
+	}
+	return nil
+}
+
+func (ic *Client) GetTransaction(ctx context.Context, params *RosettaTypes.TransactionIdentifier) (*RosettaTypes.Transaction, error) {
+	tx, _, err := ic.getTransaction(ctx, params)
+	return tx, err
 }
 
-func (ic *Client) GetTransaction(params *RosettaTypes.TransactionIdentifier) (*RosettaTypes.Transaction, error) {
+// getTransaction returns the transaction with its receipt, and the block
+// including it.
+func (ic *Client) getTransaction(
+	ctx context.Context,
+	params *RosettaTypes.TransactionIdentifier,
+) (*RosettaTypes.Transaction, *RosettaTypes.BlockIdentifier, error) {
 
 	//이렇게 하는 방법밖에 없는가?
 	var reqParams *client_v1.TransactionRPCRequest
@@ -85,73 +321,267 @@ func (ic *Client) GetTransaction(params *RosettaTypes.TransactionIdentifier) (*R
 		Hash: params.Hash,
 	}
 
-	tx, err := ic.iconV1.GetTransaction(reqParams)
+	var tx *RosettaTypes.Transaction
+	var block *RosettaTypes.BlockIdentifier
+	err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		var err error
+		tx, err = c.GetTransaction(ctx, reqParams)
+		if err != nil {
+			return fmt.Errorf("%w: could not get transaction", err)
+		}
+
+		txR, err := c.GetTransactionResult(ctx, reqParams)
+		if err != nil {
+			return fmt.Errorf("%w: could not get transaction resykt", err)
+		}
+		if err = c.ResolveTokens(ctx, []*client_v1.TransactionResult{txR}); err != nil {
+			return fmt.Errorf("%w: could not resolve tokens", err)
+		}
+		block = txR.Block()
+		tx, err = c.MakeTransactionWithReceipt(tx, txR)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get transaction", err)
+		return nil, nil, err
 	}
+	return tx, block, nil
+}
+
+func (ic *Client) GetPeer(ctx context.Context) ([]*RosettaTypes.Peer, error) {
+	var peers []*RosettaTypes.Peer
+	err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		resp, err := c.GetMainPReps(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: could not get peer", err)
+		}
+
+		var addresses []string
+		preps := (*resp)["preps"]
 
+		for _, element := range preps.([]interface{}) {
+			address := element.(map[string]interface{})["address"]
+			addresses = append(addresses, address.(string))
+		}
+
+		prepInfos, err := c.GetPReps(ctx, addresses)
+		if err != nil {
+			return fmt.Errorf("%w: could not get preps", err)
+		}
 
-	txR, err := ic.iconV1.GetTransactionResult(reqParams)
+		peers = nil
+		for i, address := range addresses {
+			peers = append(peers, &RosettaTypes.Peer{
+				PeerID:   address,
+				Metadata: prepInfos[i],
+			})
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get transaction resykt", err)
+		return nil, err
 	}
-	ic.iconV1.MakeTransactionWithReceipt(tx, txR)
-	return tx, nil
+	return peers, nil
 }
 
-func (ic *Client) GetPeer() ([]*RosettaTypes.Peer, error) {
-	resp, err := ic.iconV1.GetMainPReps()
+func (ic *Client) SendTransaction(ctx context.Context, tx client_v1.Transaction) error {
+	js, err := tx.ToJSON()
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get peer", err)
+		return err
 	}
+	return ic.pool.Submit(ctx, func(c *client_v1.ClientV3) error {
+		return c.SendTransaction(ctx, js)
+	})
+}
 
-	var peers []*RosettaTypes.Peer
-	preps := (*resp)["preps"]
-
-	for _, element := range preps.([]interface{}) {
-		address := element.(map[string]interface{})["address"]
-		resp, _ := ic.iconV1.GetPRep(address.(string))
-		peers = append(peers, &RosettaTypes.Peer{
-			PeerID:   address.(string),
-			Metadata: *resp,
-		})
+// EstimateStep estimates the steps of tx on a node which exposes the
+// debug API, skipping those which do not.
+func (ic *Client) EstimateStep(ctx context.Context, tx client_v1.Transaction) (*client_v1.Response, error) {
+	js, err := tx.ToJSON()
+	if err != nil {
+		return nil, err
 	}
+	delete(js, "signature")
+	delete(js, "stepLimit")
 
-	return peers, nil
+	var res *client_v1.Response
+	err = ic.pool.ReadDebug(ctx, func(c *client_v1.ClientV3) error {
+		var err error
+		res, err = c.EstimateStep(ctx, js)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-func (ic *Client) SendTransaction(tx client_v1.Transaction) error {
-	js, err := tx.ToJSON()
+// ErrHistoricalBalanceUnavailable is returned when the balance at a past
+// block can neither be read from a node nor rebuilt from the store.
+var ErrHistoricalBalanceUnavailable = errors.New("historical balance unavailable")
+
+// GetBalance returns the balances of an account in currencies, or in ICX
+// when currencies is empty, at block, or at the latest block when block
+// is empty. Past balances are read from a node keeping the state of past
+// blocks, and otherwise ICX balances are rebuilt from the operations in
+// the store.
+func (ic *Client) GetBalance(
+	ctx context.Context,
+	params *RosettaTypes.AccountIdentifier,
+	block *RosettaTypes.PartialBlockIdentifier,
+	currencies []*RosettaTypes.Currency,
+) (*RosettaTypes.AccountBalanceResponse, error) {
+	if params.SubAccount != nil {
+		for _, currency := range currencies {
+			if contract, err := client_v1.TokenContract(currency); err != nil || contract != "" {
+				return nil, fmt.Errorf("%w: sub-accounts only hold ICX", client_v1.ErrUnsupportedCurrency)
+			}
+		}
+		return ic.getSubAccountBalance(ctx, params, block)
+	}
+	if block == nil || (block.Index == nil && block.Hash == nil) {
+		return ic.getLatestBalance(ctx, params, currencies)
+	}
+
+	id, err := ic.resolveBlock(ctx, block)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	reqParam := &client_v1.BalanceRPCRequest{
+		Address: params.Address,
+		Filter:  "0x3",
 	}
-	if err := ic.iconV1.SendTransaction(js); err != nil {
+	height := common.HexInt64{Value: id.Index}.String()
+	var balances []*RosettaTypes.Amount
+	err = ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		var err error
+		balances, err = c.GetBalances(ctx, reqParam, currencies, height)
 		return err
+	})
+	if err == nil {
+		return &RosettaTypes.AccountBalanceResponse{
+			BlockIdentifier: id,
+			Balances:        balances,
+		}, nil
 	}
-	return nil
+	if !errors.Is(err, client_v1.ErrInvalidParams) && !errors.Is(err, client_v1.ErrMethodNotFound) {
+		return nil, err
+	}
+
+	// The node does not keep past states, or rejects the address.
+	if CheckAddress(params.Address) != nil {
+		return nil, err
+	}
+	if ic.store == nil {
+		return nil, fmt.Errorf("%w: %v", ErrHistoricalBalanceUnavailable, err)
+	}
+	balances, err = ic.storeBalances(params.Address, id.Index, currencies)
+	if err != nil {
+		return nil, err
+	}
+	return &RosettaTypes.AccountBalanceResponse{
+		BlockIdentifier: id,
+		Balances:        balances,
+	}, nil
 }
 
-func (ic *Client) EstimateStep(tx client_v1.Transaction) (*client_v1.Response, error) {
-	js, err := tx.ToJSON()
+// storeBalances rebuilds the ICX balances of address at height from the
+// store. IRC2 balances are not rebuilt, as the store only holds the
+// transfers of the tokens known when they were stored.
+func (ic *Client) storeBalances(
+	address string,
+	height int64,
+	currencies []*RosettaTypes.Currency,
+) ([]*RosettaTypes.Amount, error) {
+	if len(currencies) == 0 {
+		currencies = []*RosettaTypes.Currency{ic.currency}
+	}
+
+	balances := make([]*RosettaTypes.Amount, len(currencies))
+	for i, currency := range currencies {
+		if contract, err := client_v1.TokenContract(currency); err != nil {
+			return nil, err
+		} else if contract != "" {
+			return nil, fmt.Errorf("%w: %s balances are not kept in the store", ErrHistoricalBalanceUnavailable, currency.Symbol)
+		}
+		balance, ok, err := ic.store.BalanceAt(address, height, ic.currency)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: block %d is not in the store", ErrHistoricalBalanceUnavailable, height)
+		}
+		balances[i] = &RosettaTypes.Amount{
+			Value:    balance.Text(10),
+			Currency: currency,
+		}
+	}
+	return balances, nil
+}
+
+// getSubAccountBalance returns the balance of a staking sub-account,
+// which can only be read from a node.
+func (ic *Client) getSubAccountBalance(
+	ctx context.Context,
+	params *RosettaTypes.AccountIdentifier,
+	block *RosettaTypes.PartialBlockIdentifier,
+) (*RosettaTypes.AccountBalanceResponse, error) {
+	subAccount := params.SubAccount.Address
+
+	var result *RosettaTypes.AccountBalanceResponse
+	if block == nil || (block.Index == nil && block.Hash == nil) {
+		err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+			var err error
+			result, err = c.GetSubAccountBalance(ctx, params.Address, subAccount)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	id, err := ic.resolveBlock(ctx, block)
 	if err != nil {
 		return nil, err
 	}
-	delete(js, "signature")
-	delete(js, "stepLimit")
-	res, err := ic.iconV1.EstimateStep(js)
+	height := common.HexInt64{Value: id.Index}.String()
+
+	var amount *RosettaTypes.Amount
+	err = ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		var err error
+		amount, err = c.GetSubAccount(ctx, params.Address, subAccount, height)
+		return err
+	})
+	if (errors.Is(err, client_v1.ErrInvalidParams) || errors.Is(err, client_v1.ErrMethodNotFound)) &&
+		CheckAddress(params.Address) == nil {
+		return nil, fmt.Errorf("%w: %v", ErrHistoricalBalanceUnavailable, err)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return res, nil
+	return &RosettaTypes.AccountBalanceResponse{
+		BlockIdentifier: id,
+		Balances:        []*RosettaTypes.Amount{amount},
+	}, nil
 }
 
-func (ic *Client) GetBalance(params *RosettaTypes.AccountIdentifier) (*RosettaTypes.AccountBalanceResponse, error) {
+func (ic *Client) getLatestBalance(
+	ctx context.Context,
+	params *RosettaTypes.AccountIdentifier,
+	currencies []*RosettaTypes.Currency,
+) (*RosettaTypes.AccountBalanceResponse, error) {
 	reqParam := &client_v1.BalanceRPCRequest{
 		Address: params.Address,
 		Filter:  "0x3",
 	}
 
-	result, err := ic.iconV1.GetBalance(reqParam)
+	var result *RosettaTypes.AccountBalanceResponse
+	err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		var err error
+		result, err = c.GetBalance(ctx, reqParam, currencies)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
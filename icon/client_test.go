@@ -0,0 +1,258 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/common"
+	"github.com/icon-project/goloop/common/crypto"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"github.com/leeheonseung/rosetta-icon/icon/emulator"
+)
+
+// The fixtures in testdata/fixtures are recorded from the emulator: a
+// genesis block, a block with only the base transaction, and a block
+// with an ICX transfer from sender to receiver.
+const (
+	fixtureBlock2  = "0x104189c7d406e654cf165e84da35094375f7b38bb2dc42af32bfb34277653d9d"
+	fixtureTx      = "0x295bacd8f2cefa7aea1179f8516079de0cc71263e6d5352affd7ea4cdbbc7674"
+	fixtureSender  = "hx3850dff2bffbce648a07becd7243836863cba504"
+	fixtureReceive = "hx0000000000000000000000000000000000000001"
+	fixturePRep    = "hx1111111111111111111111111111111111111111"
+)
+
+func newReplayClient() *Client {
+	ic := NewClient([]string{"http://replay/api/v3"}, client_v1.ICXCurrency)
+	ic.SetPrefetch(0, 0)
+	ic.SetRetryPolicy(client_v1.NewRetryPolicy(1, 0))
+	ic.SetTransport(client_v1.NewReplayTransport(filepath.Join("testdata", "fixtures")))
+	return ic
+}
+
+func TestReplayGetBlock(t *testing.T) {
+	ic := newReplayClient()
+	index := int64(2)
+	block, err := ic.GetBlock(context.Background(), &RosettaTypes.PartialBlockIdentifier{Index: &index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BlockIdentifier.Index != 2 || block.BlockIdentifier.Hash != fixtureBlock2 {
+		t.Fatalf("block %+v", block.BlockIdentifier)
+	}
+	if len(block.Transactions) != 2 {
+		t.Fatalf("%d transactions", len(block.Transactions))
+	}
+
+	tx := block.Transactions[1]
+	if tx.TransactionIdentifier.Hash != fixtureTx {
+		t.Fatalf("transaction %s", tx.TransactionIdentifier.Hash)
+	}
+	want := []struct {
+		opType  string
+		address string
+		value   string
+	}{
+		{client_v1.TransferOpType, fixtureSender, "-1000"},
+		{client_v1.TransferOpType, fixtureReceive, "1000"},
+		{client_v1.FeeOpType, fixtureSender, "-1250000000000000"},
+		{client_v1.FeeOpType, client_v1.TreasuryAddress, "1250000000000000"},
+	}
+	if len(tx.Operations) != len(want) {
+		t.Fatalf("%d operations", len(tx.Operations))
+	}
+	for i, op := range tx.Operations {
+		if op.OperationIdentifier.Index != int64(i) ||
+			op.Type != want[i].opType ||
+			op.Account.Address != want[i].address ||
+			op.Amount.Value != want[i].value ||
+			op.Status != client_v1.SuccessStatus {
+			t.Errorf("operation %d is %s %s %s, want %+v",
+				i, op.Type, op.Account.Address, op.Amount.Value, want[i])
+		}
+	}
+}
+
+func TestReplayGetGenesisBlock(t *testing.T) {
+	ic := newReplayClient()
+	index := int64(0)
+	block, err := ic.GetBlock(context.Background(), &RosettaTypes.PartialBlockIdentifier{Index: &index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.ParentBlockIdentifier.Index != 0 || len(block.Transactions) != 1 {
+		t.Fatalf("genesis block %+v with %d transactions", block.ParentBlockIdentifier, len(block.Transactions))
+	}
+	ops := block.Transactions[0].Operations
+	if len(ops) != 2 || ops[0].Account.Address != fixtureSender || ops[0].Amount.Value != "1000000000000000000000" ||
+		ops[1].Type != client_v1.MessageOpType {
+		t.Fatalf("genesis operations %s", RosettaTypes.PrettyPrintStruct(ops))
+	}
+}
+
+func TestReplayGetPeer(t *testing.T) {
+	ic := newReplayClient()
+	peers, err := ic.GetPeer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].PeerID != fixturePRep {
+		t.Fatalf("peers %s", RosettaTypes.PrettyPrintStruct(peers))
+	}
+}
+
+func TestReplayMissingBlock(t *testing.T) {
+	ic := newReplayClient()
+	index := int64(3)
+	if _, err := ic.GetBlock(context.Background(), &RosettaTypes.PartialBlockIdentifier{Index: &index}); err == nil {
+		t.Fatal("expected an error for a block without fixture")
+	}
+}
+
+func TestDetectCapabilitiesSkipsFailingNodes(t *testing.T) {
+	node := emulator.NewServer(80, nil, nil)
+	defer node.Close()
+	node.NoDebug = true
+
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	ic := NewClient([]string{down.URL + "/api/v3", node.URL()}, client_v1.ICXCurrency)
+	ic.SetRetryPolicy(client_v1.NewRetryPolicy(1, 0))
+	missing, unknown, err := ic.DetectCapabilities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0] != node.URL() {
+		t.Fatalf("missing debug API %v", missing)
+	}
+	if len(unknown) != 1 {
+		t.Fatalf("unknown capabilities %v", unknown)
+	}
+
+	ic = NewClient([]string{down.URL + "/api/v3"}, client_v1.ICXCurrency)
+	ic.SetRetryPolicy(client_v1.NewRetryPolicy(1, 0))
+	if _, _, err := ic.DetectCapabilities(context.Background()); err == nil {
+		t.Fatal("expected an error when no node can be probed")
+	}
+}
+
+func TestEstimateStepSkipsNodesWithoutDebug(t *testing.T) {
+	public := emulator.NewServer(80, nil, nil)
+	defer public.Close()
+	public.NoDebug = true
+	full := emulator.NewServer(80, nil, nil)
+	defer full.Close()
+
+	tx := client_v1.Transaction{}
+	tx.Version.Value = 3
+	tx.From.SetString(fixtureSender)
+	tx.To.SetString(fixtureReceive)
+	tx.Value = common.NewHexInt(1000)
+	tx.NID = &common.HexInt64{Value: 80}
+	want := emulator.EstimateStep(&tx)
+
+	estimate := func(ic *Client) (*big.Int, error) {
+		res, err := ic.EstimateStep(context.Background(), tx)
+		if err != nil {
+			return nil, err
+		}
+		var step common.HexInt
+		if err := json.Unmarshal(res.Result, &step); err != nil {
+			t.Fatal(err)
+		}
+		return &step.Int, nil
+	}
+
+	// Before detection, the node without the debug API is asked first,
+	// and the estimate comes from the next one.
+	ic := NewClient([]string{public.URL(), full.URL()}, client_v1.ICXCurrency)
+	ic.SetRetryPolicy(client_v1.NewRetryPolicy(1, 0))
+	step, err := estimate(ic)
+	if err != nil || step.Cmp(want) != 0 {
+		t.Fatalf("estimated %v, want %s: %v", step, want, err)
+	}
+	if st := ic.Pool().Status(); !st[0].Healthy {
+		t.Fatalf("node without the debug API marked unhealthy: %+v", st[0])
+	}
+
+	// After detection, it is not asked at all: had it been, it would
+	// answer now that it exposes the debug API.
+	ic = NewClient([]string{public.URL(), full.URL()}, client_v1.ICXCurrency)
+	ic.SetRetryPolicy(client_v1.NewRetryPolicy(1, 0))
+	if _, _, err := ic.DetectCapabilities(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	public.NoDebug = false
+	full.Close()
+	if step, err := estimate(ic); err == nil || errors.Is(err, client_v1.ErrDebugUnavailable) {
+		t.Fatalf("estimated %v on a node without the debug API: %v", step, err)
+	}
+	public.NoDebug = true
+
+	// Without any node exposing the debug API, steps can not be estimated.
+	ic = NewClient([]string{public.URL()}, client_v1.ICXCurrency)
+	ic.SetRetryPolicy(client_v1.NewRetryPolicy(1, 0))
+	if _, err := estimate(ic); !errors.Is(err, client_v1.ErrDebugUnavailable) {
+		t.Fatalf("estimate on a node without the debug API: %v", err)
+	}
+}
+
+func TestReceiptPathsAgree(t *testing.T) {
+	priv, pub := crypto.GenerateKeyPair()
+	sender := common.NewAccountAddressFromPublicKey(pub).String()
+	initial, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	node := emulator.NewServer(80, map[string]*big.Int{sender: initial}, nil)
+	defer node.Close()
+	node.AutoProduce = false
+	sendTransfer(t, node, priv, fixtureReceive, 1000)
+	node.Produce()
+	ctx := context.Background()
+
+	getBlock := func(index int64, noBlockReceipts bool) *RosettaTypes.Block {
+		node.NoBlockReceipts = noBlockReceipts
+		ic := NewClient([]string{node.URL()}, client_v1.ICXCurrency)
+		ic.SetPrefetch(0, 0)
+		block, err := ic.GetBlock(ctx, &RosettaTypes.PartialBlockIdentifier{Index: &index})
+		if err != nil {
+			t.Fatalf("block %d: %v", index, err)
+		}
+		if ic.Pool().Clients()[0].HasBlockReceipts() == noBlockReceipts {
+			t.Fatalf("block %d: receipts not read the expected way", index)
+		}
+		return block
+	}
+
+	// The receipts read one transaction at a time make the same blocks as
+	// the ones read with icx_getBlockReceipts, the genesis block included.
+	for index := int64(0); index <= 1; index++ {
+		byBlock := getBlock(index, false)
+		byTx := getBlock(index, true)
+		if !reflect.DeepEqual(byBlock, byTx) {
+			a, _ := json.Marshal(byBlock)
+			b, _ := json.Marshal(byTx)
+			t.Fatalf("block %d:\n%s\n%s", index, a, b)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/icon-project/goloop/server/jsonrpc"
+)
+
+// BatchElem is a single call of a batch request. Result must be a pointer
+// the call result is decoded into, and Error is set when that single call
+// failed.
+type BatchElem struct {
+	Method string
+	Params interface{}
+	Result interface{}
+	Error  error
+}
+
+type batchResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *jsonrpc.Error  `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// DoBatch sends all elems to the default endpoint in one round trip.
+func (c *JsonRpcClient) DoBatch(ctx context.Context, elems []*BatchElem) error {
+	return c.DoBatchURL(ctx, c.Endpoint, elems)
+}
+
+// DoBatchURL sends all elems to url as a single JSON-RPC 2.0 batch and
+// matches the responses to elems by ID. The returned error covers the
+// whole batch; failures of single calls are reported in BatchElem.Error.
+//
+// Nodes which reject batch requests are detected on the first attempt,
+// and the calls are sent one by one from then on.
+func (c *JsonRpcClient) DoBatchURL(ctx context.Context, url string, elems []*BatchElem) error {
+	if len(elems) == 0 {
+		return nil
+	}
+	if atomic.LoadInt32(&c.noBatch) != 0 {
+		return c.doSequential(ctx, url, elems)
+	}
+
+	reqs := make([]*jsonrpc.Request, len(elems))
+	for i, elem := range elems {
+		reqs[i] = &jsonrpc.Request{
+			ID:      i + 1,
+			Version: jsonrpc.Version,
+			Method:  elem.Method,
+		}
+		if elem.Params != nil {
+			b, err := json.Marshal(elem.Params)
+			if err != nil {
+				return err
+			}
+			reqs[i].Params = json.RawMessage(b)
+		}
+	}
+	reqB, err := json.Marshal(reqs)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = c.postBatch(ctx, url, reqB, elems)
+		if isBatchUnsupported(err) {
+			atomic.StoreInt32(&c.noBatch, 1)
+			return c.doSequential(ctx, url, elems)
+		}
+		if err == nil || !c.shouldRetryBatch(elems, attempt, err) {
+			return newNodeError("batch", err)
+		}
+		if wErr := c.Retry.wait(ctx, attempt); wErr != nil {
+			return newNodeError("batch", err)
+		}
+	}
+}
+
+func (c *JsonRpcClient) shouldRetryBatch(elems []*BatchElem, attempt int, err error) bool {
+	for _, elem := range elems {
+		if !c.Retry.ShouldRetry(elem.Method, attempt, err) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *JsonRpcClient) doSequential(ctx context.Context, url string, elems []*BatchElem) error {
+	for _, elem := range elems {
+		_, elem.Error = c.DoURL(ctx, url, elem.Method, elem.Params, elem.Result)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *JsonRpcClient) postBatch(ctx context.Context, url string, reqB []byte, elems []*BatchElem) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqB))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerContentType, typeApplicationJSON)
+	req.Header.Set(headerAccept, typeApplicationJSON)
+	for k, v := range c.CustomHeader {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c._do(req)
+	if resp == nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var raw json.RawMessage
+	if dErr := json.NewDecoder(resp.Body).Decode(&raw); dErr != nil {
+		if err != nil {
+			return &HttpError{StatusCode: resp.StatusCode, message: "HTTP " + resp.Status}
+		}
+		return fmt.Errorf("fail to decode batch response body err:%+v", dErr)
+	}
+
+	var jrResps []*batchResponse
+	if uErr := json.Unmarshal(raw, &jrResps); uErr != nil {
+		// A single response object instead of an array means that the
+		// batch as a whole was rejected.
+		var single batchResponse
+		if sErr := json.Unmarshal(raw, &single); sErr == nil && single.Error != nil {
+			return single.Error
+		}
+		if err != nil {
+			return &HttpError{StatusCode: resp.StatusCode, message: "HTTP " + resp.Status}
+		}
+		return fmt.Errorf("fail to decode batch response err:%+v", uErr)
+	}
+
+	byID := make(map[string]*batchResponse, len(jrResps))
+	for _, jrResp := range jrResps {
+		byID[strings.Trim(string(jrResp.ID), `"`)] = jrResp
+	}
+	for i, elem := range elems {
+		jrResp, ok := byID[strconv.Itoa(i+1)]
+		switch {
+		case !ok:
+			elem.Error = fmt.Errorf("no response for %s in batch", elem.Method)
+		case jrResp.Error != nil:
+			elem.Error = newNodeError(elem.Method, jrResp.Error)
+		case elem.Result != nil:
+			elem.Error = json.Unmarshal(jrResp.Result, elem.Result)
+		}
+	}
+	return nil
+}
+
+func isBatchUnsupported(err error) bool {
+	var jErr *jsonrpc.Error
+	if errors.As(err, &jErr) {
+		switch jErr.Code {
+		case jsonrpc.ErrorCodeJsonParse, jsonrpc.ErrorCodeInvalidRequest:
+			return true
+		}
+	}
+	return false
+}
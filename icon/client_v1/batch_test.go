@@ -0,0 +1,191 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/icon-project/goloop/server/jsonrpc"
+)
+
+// batchServer answers every request with the body reply returns for its
+// calls, and counts the batch and single requests it gets.
+func batchServer(
+	t *testing.T,
+	reply func(reqs []*jsonrpc.Request, batch bool) interface{},
+) (*httptest.Server, *int32, *int32) {
+	var batches, singles int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs, batch, err := decodeRequests(b)
+		if err != nil {
+			t.Errorf("invalid request %s: %v", b, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if batch {
+			atomic.AddInt32(&batches, 1)
+		} else {
+			atomic.AddInt32(&singles, 1)
+		}
+		w.Header().Set(headerContentType, typeApplicationJSON)
+		_ = json.NewEncoder(w).Encode(reply(reqs, batch))
+	}))
+	return srv, &batches, &singles
+}
+
+func batchResult(req *jsonrpc.Request) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": jsonrpc.Version,
+		"id":      req.ID,
+		"result":  req.Method,
+	}
+}
+
+func batchError(req *jsonrpc.Request, code jsonrpc.ErrorCode) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": jsonrpc.Version,
+		"id":      req.ID,
+		"error":   map[string]interface{}{"code": code, "message": "failed"},
+	}
+}
+
+func batchElems(methods ...string) []*BatchElem {
+	elems := make([]*BatchElem, len(methods))
+	for i, method := range methods {
+		elems[i] = &BatchElem{Method: method, Result: new(string)}
+	}
+	return elems
+}
+
+func TestBatchPartialFailure(t *testing.T) {
+	srv, _, _ := batchServer(t, func(reqs []*jsonrpc.Request, batch bool) interface{} {
+		resps := make([]interface{}, len(reqs))
+		for i, req := range reqs {
+			if req.Method == "icx_getTransactionResult" {
+				resps[i] = batchError(req, jsonrpc.ErrorCodeNotFound)
+			} else {
+				resps[i] = batchResult(req)
+			}
+		}
+		return resps
+	})
+	defer srv.Close()
+
+	c := newFixtureClient(srv.URL, http.DefaultTransport)
+	elems := batchElems("icx_getBlock", "icx_getTransactionResult", "icx_getLastBlock")
+	if err := c.DoBatch(context.Background(), elems); err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range elems {
+		if elem.Method == "icx_getTransactionResult" {
+			if !errors.Is(elem.Error, ErrNotFound) {
+				t.Fatalf("%s failed with %v", elem.Method, elem.Error)
+			}
+			continue
+		}
+		if elem.Error != nil || *elem.Result.(*string) != elem.Method {
+			t.Fatalf("%s returned %q, %v", elem.Method, *elem.Result.(*string), elem.Error)
+		}
+	}
+}
+
+func TestBatchResponsesOutOfOrder(t *testing.T) {
+	srv, _, _ := batchServer(t, func(reqs []*jsonrpc.Request, batch bool) interface{} {
+		// The responses come back in reverse, without the first call.
+		var resps []interface{}
+		for i := len(reqs) - 1; i > 0; i-- {
+			resps = append(resps, batchResult(reqs[i]))
+		}
+		return resps
+	})
+	defer srv.Close()
+
+	c := newFixtureClient(srv.URL, http.DefaultTransport)
+	elems := batchElems("icx_getBlock", "icx_getBlockReceipts", "icx_getLastBlock")
+	if err := c.DoBatch(context.Background(), elems); err != nil {
+		t.Fatal(err)
+	}
+	if elems[0].Error == nil {
+		t.Fatalf("%s without response returned %q", elems[0].Method, *elems[0].Result.(*string))
+	}
+	for _, elem := range elems[1:] {
+		if elem.Error != nil || *elem.Result.(*string) != elem.Method {
+			t.Fatalf("%s returned %q, %v", elem.Method, *elem.Result.(*string), elem.Error)
+		}
+	}
+}
+
+func TestBatchErrorReply(t *testing.T) {
+	srv, batches, singles := batchServer(t, func(reqs []*jsonrpc.Request, batch bool) interface{} {
+		return map[string]interface{}{
+			"jsonrpc": jsonrpc.Version,
+			"id":      nil,
+			"error":   map[string]interface{}{"code": jsonrpc.ErrorCodeServer, "message": "busy"},
+		}
+	})
+	defer srv.Close()
+
+	// A single error instead of an array fails the whole batch.
+	c := newFixtureClient(srv.URL, http.DefaultTransport)
+	elems := batchElems("icx_getBlock", "icx_getBlockReceipts")
+	err := c.DoBatch(context.Background(), elems)
+	if !errors.Is(err, ErrServer) {
+		t.Fatalf("batch failed with %v", err)
+	}
+	for _, elem := range elems {
+		if elem.Error != nil || *elem.Result.(*string) != "" {
+			t.Fatalf("%s returned %q, %v", elem.Method, *elem.Result.(*string), elem.Error)
+		}
+	}
+	if *batches != 1 || *singles != 0 {
+		t.Fatalf("%d batch and %d single requests", *batches, *singles)
+	}
+}
+
+func TestBatchUnsupported(t *testing.T) {
+	srv, batches, singles := batchServer(t, func(reqs []*jsonrpc.Request, batch bool) interface{} {
+		if batch {
+			return batchError(&jsonrpc.Request{}, jsonrpc.ErrorCodeInvalidRequest)
+		}
+		return batchResult(reqs[0])
+	})
+	defer srv.Close()
+
+	// A node which rejects batches gets the calls one by one, from the
+	// first batch on.
+	c := newFixtureClient(srv.URL, http.DefaultTransport)
+	for i := 0; i < 2; i++ {
+		elems := batchElems("icx_getBlock", "icx_getBlockReceipts")
+		if err := c.DoBatch(context.Background(), elems); err != nil {
+			t.Fatal(err)
+		}
+		for _, elem := range elems {
+			if elem.Error != nil || *elem.Result.(*string) != elem.Method {
+				t.Fatalf("%s returned %q, %v", elem.Method, *elem.Result.(*string), elem.Error)
+			}
+		}
+	}
+	if *batches != 1 || *singles != 4 {
+		t.Fatalf("%d batch and %d single requests", *batches, *singles)
+	}
+}
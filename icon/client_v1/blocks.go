@@ -58,3 +58,46 @@ func ParseBlock03(blk *Block03) (*types.Block, error) {
 		Metadata:     blk.Meta(),
 	}, nil
 }
+
+// ParseBlock20 converts a goloop block. Only the genesis block of a chain
+// started on goloop is in this format; chains migrated from ICON 1 keep
+// their 0.1a genesis block.
+func ParseBlock20(blk *Block20) (*types.Block, error) {
+	if blk.Number() == GenesisBlockIndex {
+		transactions, err := ParseGenesisTransaction(blk.Transactions)
+		if err != nil {
+			return nil, err
+		}
+		return &types.Block{
+			BlockIdentifier: &types.BlockIdentifier{
+				Index: blk.Number(),
+				Hash:  blk.Hash(),
+			},
+			ParentBlockIdentifier: &types.BlockIdentifier{
+				Index: blk.Number(),
+				Hash:  blk.Hash(),
+			},
+			Timestamp:    blk.TimestampMilli(),
+			Transactions: transactions,
+			Metadata:     blk.Meta(),
+		}, nil
+	}
+
+	transactions, err := ParseTransactions(blk.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Block{
+		BlockIdentifier: &types.BlockIdentifier{
+			Index: blk.Number(),
+			Hash:  blk.Hash(),
+		},
+		ParentBlockIdentifier: &types.BlockIdentifier{
+			Index: blk.Number() - 1,
+			Hash:  blk.PrevHash(),
+		},
+		Timestamp:    blk.TimestampMilli(),
+		Transactions: transactions,
+		Metadata:     blk.Meta(),
+	}, nil
+}
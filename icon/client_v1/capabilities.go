@@ -0,0 +1,123 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/icon-project/goloop/common"
+)
+
+// Support of the debug API by a node.
+const (
+	debugUnknown int32 = iota
+	debugAvailable
+	debugUnavailable
+)
+
+// ErrDebugUnavailable is returned for requests which need the debug API
+// of a node which does not expose it.
+var ErrDebugUnavailable = errors.New("debug endpoint unavailable")
+
+// DetectCapabilities checks whether the node exposes the debug API at
+// DebugEndPoint. Until it is called, the debug API is assumed to be
+// there, and only given up on once a request shows it is missing.
+func (c *ClientV3) DetectCapabilities(ctx context.Context) error {
+	if c.DebugEndPoint == "" {
+		atomic.StoreInt32(&c.debug, debugUnavailable)
+		return nil
+	}
+
+	param := &BalanceRPCRequest{Address: TreasuryAddress, Filter: "0x1"}
+	var account *DebugAccount
+	_, err := c.DoURL(ctx, c.DebugEndPoint, "debug_getAccount", param, &account)
+	switch {
+	case err == nil, errors.Is(err, ErrInvalidParams):
+		atomic.StoreInt32(&c.debug, debugAvailable)
+	case methodMissing(err):
+		atomic.StoreInt32(&c.debug, debugUnavailable)
+	default:
+		return err
+	}
+	return nil
+}
+
+// HasDebug reports whether the debug API of the node is used.
+func (c *ClientV3) HasDebug() bool {
+	return atomic.LoadInt32(&c.debug) != debugUnavailable
+}
+
+// doDebug sends a request to the debug API, unless the node is known not
+// to expose it.
+func (c *ClientV3) doDebug(ctx context.Context, method string, reqPtr, respPtr interface{}) (*Response, error) {
+	if !c.HasDebug() || c.DebugEndPoint == "" {
+		return nil, fmt.Errorf("%w: %s", ErrDebugUnavailable, method)
+	}
+	res, err := c.DoURL(ctx, c.DebugEndPoint, method, reqPtr, respPtr)
+	if methodMissing(err) {
+		atomic.StoreInt32(&c.debug, debugUnavailable)
+		return nil, fmt.Errorf("%w: %v", ErrDebugUnavailable, err)
+	}
+	return res, err
+}
+
+// methodMissing reports whether err shows that the endpoint does not
+// expose the method, rather than that the node failed to serve a request.
+func methodMissing(err error) bool {
+	if errors.Is(err, ErrMethodNotFound) {
+		return true
+	}
+	var hErr *HttpError
+	return errors.As(err, &hErr) &&
+		hErr.StatusCode >= http.StatusBadRequest && hErr.StatusCode < http.StatusInternalServerError
+}
+
+// getIISSAccount reads the coin and stake balances of param.Address
+// without the debug API, from icx_getBalance and getStake.
+func (c *ClientV3) getIISSAccount(ctx context.Context, param *BalanceRPCRequest) (*DebugAccount, error) {
+	account := &DebugAccount{
+		Coin: coin{Balance: new(common.HexInt)},
+		Stake: stake{
+			Stake:   new(common.HexInt),
+			UnStake: new(common.HexInt),
+		},
+	}
+
+	balanceParam := &BalanceRPCRequest{Address: param.Address, Height: param.Height}
+	if _, err := c.Do(ctx, "icx_getBalance", balanceParam, account.Coin.Balance); err != nil {
+		return nil, err
+	}
+
+	var s Stake
+	if err := c.callSystem(ctx, "getStake", param.Address, param.Height, &s); err != nil {
+		return nil, err
+	}
+	if s.Stake != nil {
+		account.Stake.Stake = s.Stake
+	}
+	unstake := new(big.Int)
+	for _, u := range s.AllUnstakes() {
+		if u.Unstake != nil {
+			unstake.Add(unstake, &u.Unstake.Int)
+		}
+	}
+	account.Stake.UnStake.Set(unstake)
+	return account, nil
+}
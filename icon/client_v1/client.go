@@ -15,7 +15,9 @@
 package client_v1
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/icon-project/goloop/common"
 	"github.com/icon-project/goloop/server/jsonrpc"
@@ -28,6 +30,14 @@ import (
 type ClientV3 struct {
 	*JsonRpcClient
 	DebugEndPoint string
+	Tokens        *TokenRegistry
+
+	// ReceiptWorkers bounds the icx_getTransactionResult requests sent
+	// concurrently when the node does not serve block receipts.
+	ReceiptWorkers int
+
+	debug           int32
+	noBlockReceipts int32
 }
 
 func guessDebugEndpoint(endpoint string) string {
@@ -61,15 +71,14 @@ func NewClientV3(endpoint string) *ClientV3 {
 	}
 }
 
-func (c *ClientV3) GetBlock(param *BlockRPCRequest) (*types.Block, error) {
-	blockRaw := map[string]interface{}{}
+func (c *ClientV3) GetBlock(ctx context.Context, param *BlockRPCRequest) (*types.Block, error) {
+	var blockRaw json.RawMessage
 
-	_, err := c.Do("icx_getBlock", param, &blockRaw)
+	_, err := c.Do(ctx, "icx_getBlock", param, &blockRaw)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO Block을 Version에 맞춰서 변환
 	block, err := ParseBlock(blockRaw)
 	if err != nil {
 		return nil, err
@@ -77,10 +86,10 @@ func (c *ClientV3) GetBlock(param *BlockRPCRequest) (*types.Block, error) {
 	return block, nil
 }
 
-func (c *ClientV3) GetBlockReceipts(param *BlockRPCRequest) ([]*TransactionResult, error) {
-	trsRaw := &[]interface{}{}
+func (c *ClientV3) GetBlockReceipts(ctx context.Context, param *BlockRPCRequest) ([]*TransactionResult, error) {
+	var trsRaw []*TransactionResult
 
-	_, err := c.Do("icx_getBlockReceipts", param, trsRaw)
+	_, err := c.Do(ctx, "icx_getBlockReceipts", param, &trsRaw)
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +101,74 @@ func (c *ClientV3) GetBlockReceipts(param *BlockRPCRequest) ([]*TransactionResul
 	return trsArray, nil
 }
 
+// GetBlockWithReceipts fetches a block and its receipts in one batch
+// request. param must select the block by height or by hash, so both
+// calls are guaranteed to refer to the same block. The receipts are read
+// by transaction when the node does not serve those of the block.
+func (c *ClientV3) GetBlockWithReceipts(ctx context.Context, param *BlockRPCRequest) (*types.Block, []*TransactionResult, error) {
+	if !c.HasBlockReceipts() {
+		block, err := c.GetBlock(ctx, param)
+		if err != nil {
+			return nil, nil, err
+		}
+		trsArray, err := c.GetTransactionResults(ctx, block)
+		if err != nil {
+			return nil, nil, err
+		}
+		return block, trsArray, nil
+	}
+
+	var blockRaw json.RawMessage
+	var trsRaw []*TransactionResult
+
+	elems := []*BatchElem{
+		{Method: "icx_getBlock", Params: param, Result: &blockRaw},
+		{Method: "icx_getBlockReceipts", Params: param, Result: &trsRaw},
+	}
+	if err := c.DoBatch(ctx, elems); err != nil {
+		return nil, nil, err
+	}
+	if elems[0].Error != nil {
+		return nil, nil, elems[0].Error
+	}
+
+	block, err := ParseBlock(blockRaw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if elems[1].Error != nil {
+		var trsArray []*TransactionResult
+		switch {
+		case param.Height != "":
+			// Some nodes only look up receipts by block hash.
+			trsArray, err = c.GetReceipts(ctx, block)
+		case c.receiptsUnsupported(elems[1].Error):
+			trsArray, err = c.GetTransactionResults(ctx, block)
+		default:
+			return nil, nil, elems[1].Error
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return block, trsArray, nil
+	}
+
+	trsArray, err := ParseTransactionResults(trsRaw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, trsArray, nil
+}
+
+// MakeBlockWithReceipts adds the fees and the operations of events from
+// the receipts of block, which are paired with its transactions by hash.
 func (c *ClientV3) MakeBlockWithReceipts(block *types.Block, trsArray []*TransactionResult) (*types.Block, error) {
+	trsArray, err := matchReceipts(block, trsArray)
+	if err != nil {
+		return nil, err
+	}
+
 	zeroBigInt := new(big.Int)
 	fa := SystemScoreAddress
 	for index, tx := range block.Transactions {
@@ -111,7 +187,8 @@ func (c *ClientV3) MakeBlockWithReceipts(block *types.Block, trsArray []*Transac
 			fa = tx.Operations[0].Account.Address
 		}
 		if trsArray[index].EventLogs != nil {
-			ops := GetOperations(fa, trsArray[index].EventLogs, int64(len(tx.Operations))-1)
+			ec := &EventContext{From: fa, To: trsArray[index].ToAddr(), Tokens: c.Tokens}
+			ops := GetOperations(ec, trsArray[index].EventLogs, int64(len(tx.Operations))-1)
 			tx.Operations = append(tx.Operations, ops...)
 		}
 		for _, op := range tx.Operations {
@@ -119,39 +196,50 @@ func (c *ClientV3) MakeBlockWithReceipts(block *types.Block, trsArray []*Transac
 				op.Status = trsArray[index].StatusFlag
 			}
 		}
+		addReceiptMeta(tx, trsArray[index])
 	}
 	return block, nil
 }
 
-func (c *ClientV3) GetTransaction(param *TransactionRPCRequest) (*types.Transaction, error) {
-	txRaw := map[string]interface{}{}
+func (c *ClientV3) GetTransaction(ctx context.Context, param *TransactionRPCRequest) (*types.Transaction, error) {
+	var txRaw json.RawMessage
 
-	_, err := c.Do("icx_getTransactionByHash", param, &txRaw)
+	_, err := c.Do(ctx, "icx_getTransactionByHash", param, &txRaw)
 	if err != nil {
 		return nil, err
 	}
 
-	var txRaws []json.RawMessage
-	b, _ := json.Marshal(&txRaw)
-	raw := json.RawMessage(b)
-	txRaws = append(txRaws, raw)
-	txs, _ := ParseTransactions(txRaws)
+	txs, err := ParseTransactions([]json.RawMessage{txRaw})
+	if err != nil {
+		return nil, err
+	}
 	return txs[0], nil
 }
 
-func (c *ClientV3) GetTransactionResult(param *TransactionRPCRequest) (*TransactionResult, error) {
-	trRaw := map[string]interface{}{}
+func (c *ClientV3) GetTransactionResult(ctx context.Context, param *TransactionRPCRequest) (*TransactionResult, error) {
+	txRs := &TransactionResult{}
 
-	_, err := c.Do("icx_getTransactionResult", param, &trRaw)
+	_, err := c.Do(ctx, "icx_getTransactionResult", param, txRs)
 	if err != nil {
 		return nil, err
 	}
 
-	txRs, _ := ParseTransactionResult(trRaw)
+	if err := ParseTransactionResult(txRs); err != nil {
+		return nil, err
+	}
 	return txRs, nil
 }
 
+// MakeTransactionWithReceipt adds the fee and the operations of events
+// from txResult, which must be the receipt of tx.
 func (c *ClientV3) MakeTransactionWithReceipt(tx *types.Transaction, txResult *TransactionResult) (*types.Transaction, error) {
+	if NormalizeHash(txResult.Hash()) != NormalizeHash(tx.TransactionIdentifier.Hash) {
+		return nil, &ReceiptMismatchError{
+			Missing: []string{tx.TransactionIdentifier.Hash},
+			Extra:   []string{txResult.Hash()},
+		}
+	}
+
 	zeroBigInt := new(big.Int)
 	fa := SystemScoreAddress
 	if len(tx.Operations) >= 4 { //general tx(transfer, call, deploy...)
@@ -168,7 +256,8 @@ func (c *ClientV3) MakeTransactionWithReceipt(tx *types.Transaction, txResult *T
 		fa = tx.Operations[0].Account.Address
 	}
 	if txResult.EventLogs != nil {
-		ops := GetOperations(fa, txResult.EventLogs, int64(len(tx.Operations))-1)
+		ec := &EventContext{From: fa, To: txResult.ToAddr(), Tokens: c.Tokens}
+		ops := GetOperations(ec, txResult.EventLogs, int64(len(tx.Operations))-1)
 		tx.Operations = append(tx.Operations, ops...)
 	}
 	for _, op := range tx.Operations {
@@ -176,45 +265,197 @@ func (c *ClientV3) MakeTransactionWithReceipt(tx *types.Transaction, txResult *T
 			op.Status = txResult.StatusFlag
 		}
 	}
+	addReceiptMeta(tx, txResult)
 	return tx, nil
 }
 
-func (c *ClientV3) GetBalance(param *BalanceRPCRequest) (*types.AccountBalanceResponse, error) {
-	var debugAccount *DebugAccount
-	var blk BalanceWithBlockId
-
-	if _, blkErr := c.Do("icx_getLastBlock", nil, &blk); blkErr != nil {
-		return nil, blkErr
+// addReceiptMeta adds the outcome of tx to its metadata, so that a failure
+// can be explained without asking the node. Only the transfer operations
+// of a failed transaction fail; the fee is charged all the same.
+// The steps are decimal, like the amounts of operations and the step limit
+// of version 3 transactions.
+func addReceiptMeta(tx *types.Transaction, txResult *TransactionResult) {
+	if tx.Metadata == nil {
+		tx.Metadata = map[string]interface{}{}
+	}
+	tx.Metadata["status"] = txResult.StatusFlag
+	if txResult.StepUsed != nil {
+		tx.Metadata["stepUsed"] = txResult.StepUsed.Text(10)
 	}
+	if txResult.StepPrice != nil {
+		tx.Metadata["stepPrice"] = txResult.StepPrice.Text(10)
+	}
+	if score := txResult.ScoreAddr(); score != "" {
+		tx.Metadata["scoreAddress"] = score
+	}
+	if failure := txResult.FailureReason(); failure != nil {
+		tx.Metadata["failure"] = failure
+	}
+}
 
-	if _, err := c.DoURL(c.DebugEndPoint, "debug_getAccount", param, &debugAccount); err != nil {
+// ErrUnstableHead is returned when the balance of an account could not
+// be tied to a block, because new blocks kept landing while it was read.
+var ErrUnstableHead = errors.New("chain head moved while reading balance")
+
+// unpinnedBalanceAttempts is the number of reads of an account balance on
+// a node which can not read it at a given height.
+const unpinnedBalanceAttempts = 3
+
+// GetBalance returns the balances of param.Address in currencies, or in
+// ICX when currencies is empty, along with the block they were read at.
+func (c *ClientV3) GetBalance(
+	ctx context.Context,
+	param *BalanceRPCRequest,
+	currencies []*types.Currency,
+) (*types.AccountBalanceResponse, error) {
+	var balances []*types.Amount
+	header, err := c.atLatestBlock(ctx, func(height string) error {
+		var err error
+		balances, err = c.GetBalances(ctx, param, currencies, height)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &types.AccountBalanceResponse{
-		BlockIdentifier: &types.BlockIdentifier{
-			Index: blk.Number(),
-			Hash:  blk.Hash(),
-		},
-		Balances: []*types.Amount{
-			{
-				Value:    debugAccount.Balance(),
-				Currency: ICXCurrency,
-			},
-		},
+		BlockIdentifier: header.Identifier(),
+		Balances:        balances,
 	}, nil
 }
 
-func (c *ClientV3) GetTotalSupply() (*jsonrpc.HexInt, error) {
+// GetBalances returns the balances of param.Address in currencies, or in
+// ICX when currencies is empty, all at height when it is not empty. ICX
+// balances include the staked and unstaking ICX, IRC2 balances are read
+// with balanceOf.
+func (c *ClientV3) GetBalances(
+	ctx context.Context,
+	param *BalanceRPCRequest,
+	currencies []*types.Currency,
+	height string,
+) ([]*types.Amount, error) {
+	if len(currencies) == 0 {
+		currencies = []*types.Currency{ICXCurrency}
+	}
+
+	balances := make([]*types.Amount, len(currencies))
+	for i, currency := range currencies {
+		contract, err := TokenContract(currency)
+		if err != nil {
+			return nil, err
+		}
+
+		var value string
+		if contract == "" {
+			pinned := *param
+			pinned.Height = height
+			account, err := c.GetAccount(ctx, &pinned)
+			if err != nil {
+				return nil, err
+			}
+			value = account.Balance()
+		} else {
+			value, err = c.GetTokenBalance(ctx, contract, param.Address, height)
+			if err != nil {
+				return nil, err
+			}
+		}
+		balances[i] = &types.Amount{
+			Value:    value,
+			Currency: currency,
+		}
+	}
+	return balances, nil
+}
+
+// atLatestBlock calls read with the height of the latest block, and
+// returns that block. Nodes which do not accept a height are read with an
+// empty height instead, and asked for the latest block again afterwards,
+// until it did not change in between.
+func (c *ClientV3) atLatestBlock(ctx context.Context, read func(height string) error) (*BlockHeader, error) {
+	header, err := c.GetLastBlockHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = read(header.Height.String())
+	if errors.Is(err, ErrInvalidParams) || errors.Is(err, ErrMethodNotFound) {
+		err = ErrUnstableHead
+		for i := 0; i < unpinnedBalanceAttempts && err == ErrUnstableHead; i++ {
+			var after *BlockHeader
+			if err = read(""); err != nil {
+				break
+			}
+			if after, err = c.GetLastBlockHeader(ctx); err != nil {
+				break
+			}
+			if after.Height.Value != header.Height.Value {
+				header, err = after, ErrUnstableHead
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// GetAccount returns the coin and stake balances of param.Address, at
+// param.Height when it is set. Nodes without the debug API are asked
+// with icx_getBalance and getStake instead.
+func (c *ClientV3) GetAccount(ctx context.Context, param *BalanceRPCRequest) (*DebugAccount, error) {
+	var debugAccount *DebugAccount
+	_, err := c.doDebug(ctx, "debug_getAccount", param, &debugAccount)
+	if errors.Is(err, ErrDebugUnavailable) {
+		return c.getIISSAccount(ctx, param)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return debugAccount, nil
+}
+
+// GetLastBlockHeader returns the header of the latest block without
+// parsing its transactions. icx_getLastBlock still returns the whole
+// block, since there is no call for the header alone.
+func (c *ClientV3) GetLastBlockHeader(ctx context.Context) (*BlockHeader, error) {
+	var header BlockHeader
+	if _, err := c.Do(ctx, "icx_getLastBlock", nil, &header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// GetBlockHeader returns the header of the block matching param, without
+// parsing its transactions or reading their receipts.
+func (c *ClientV3) GetBlockHeader(ctx context.Context, param *BlockRPCRequest) (*BlockHeader, error) {
+	var header anyBlockHeader
+	if _, err := c.Do(ctx, "icx_getBlock", param, &header); err != nil {
+		return nil, err
+	}
+	return header.header(), nil
+}
+
+// GetLastBlockIdentifier returns the identifier of the latest block
+// without parsing its transactions.
+func (c *ClientV3) GetLastBlockIdentifier(ctx context.Context) (*types.BlockIdentifier, error) {
+	header, err := c.GetLastBlockHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return header.Identifier(), nil
+}
+
+func (c *ClientV3) GetTotalSupply(ctx context.Context) (*jsonrpc.HexInt, error) {
 	var result jsonrpc.HexInt
-	_, err := c.Do("icx_getTotalSupply", nil, &result)
+	_, err := c.Do(ctx, "icx_getTotalSupply", nil, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
-func (c *ClientV3) GetMainPReps() (*map[string]interface{}, error) {
+func (c *ClientV3) GetMainPReps(ctx context.Context) (*map[string]interface{}, error) {
 	resp := map[string]interface{}{}
 
 	params := map[string]interface{}{
@@ -225,14 +466,14 @@ func (c *ClientV3) GetMainPReps() (*map[string]interface{}, error) {
 		},
 	}
 
-	_, err := c.Do("icx_call", params, &resp)
+	_, err := c.Do(ctx, "icx_call", params, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (c *ClientV3) GetPRep(prep string) (*map[string]interface{}, error) {
+func (c *ClientV3) GetPRep(ctx context.Context, prep string) (*map[string]interface{}, error) {
 	resp := map[string]interface{}{}
 
 	params := map[string]interface{}{
@@ -246,25 +487,60 @@ func (c *ClientV3) GetPRep(prep string) (*map[string]interface{}, error) {
 		},
 	}
 
-	_, err := c.Do("icx_call", params, &resp)
+	_, err := c.Do(ctx, "icx_call", params, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (c *ClientV3) SendTransaction(req interface{}) error {
+// GetPReps fetches the P-Rep information of every address in one batch
+// request. The results are in the same order as preps.
+func (c *ClientV3) GetPReps(ctx context.Context, preps []string) ([]map[string]interface{}, error) {
+	resps := make([]map[string]interface{}, len(preps))
+	elems := make([]*BatchElem, len(preps))
+	for i, prep := range preps {
+		elems[i] = &BatchElem{
+			Method: "icx_call",
+			Params: map[string]interface{}{
+				"to":       "cx0000000000000000000000000000000000000000",
+				"dataType": "call",
+				"data": map[string]interface{}{
+					"method": "getPRep",
+					"params": map[string]interface{}{
+						"address": prep,
+					},
+				},
+			},
+			Result: &resps[i],
+		}
+	}
+
+	if err := c.DoBatch(ctx, elems); err != nil {
+		return nil, err
+	}
+	for _, elem := range elems {
+		if elem.Error != nil {
+			return nil, elem.Error
+		}
+	}
+	return resps, nil
+}
+
+func (c *ClientV3) SendTransaction(ctx context.Context, req interface{}) error {
 	resp := ""
-	_, err := c.Do("icx_sendTransaction", req, &resp)
+	_, err := c.Do(ctx, "icx_sendTransaction", req, &resp)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *ClientV3) EstimateStep(req interface{}) (*Response, error) {
+// EstimateStep returns the steps req would use. It fails with
+// ErrDebugUnavailable on nodes without the debug API.
+func (c *ClientV3) EstimateStep(ctx context.Context, req interface{}) (*Response, error) {
 	resp := ""
-	res, err := c.DoURL(c.DebugEndPoint, "debug_estimateStep", req, &resp)
+	res, err := c.doDebug(ctx, "debug_estimateStep", req, &resp)
 	if err != nil {
 		return nil, err
 	}
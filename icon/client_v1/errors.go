@@ -0,0 +1,118 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/icon-project/goloop/server/jsonrpc"
+)
+
+// Kinds of node request failures. A failed request can be checked against
+// them with errors.Is.
+var (
+	ErrInvalidParams  = errors.New("invalid params")
+	ErrMethodNotFound = errors.New("method not found")
+	ErrNotFound       = errors.New("not found")
+	ErrPending        = errors.New("transaction pending")
+	ErrExecuting      = errors.New("transaction executing")
+	ErrTimeout        = errors.New("node timeout")
+	ErrServer         = errors.New("node server error")
+	ErrScore          = errors.New("score execution failed")
+	ErrHTTP           = errors.New("node http error")
+	ErrUnavailable    = errors.New("node unavailable")
+)
+
+// NodeError is returned when a node request fails with a known kind of
+// failure. It wraps the original error, which is a *jsonrpc.Error, an
+// *HttpError or a transport error.
+type NodeError struct {
+	Kind   error
+	Method string
+	Err    error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Method, e.Kind, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NodeError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// newNodeError wraps err into a NodeError of the matching kind. Errors of
+// unknown kind and cancelled requests are returned unchanged.
+func newNodeError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var nErr *NodeError
+	if errors.As(err, &nErr) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &NodeError{Kind: kind, Method: method, Err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+
+	var jErr *jsonrpc.Error
+	if errors.As(err, &jErr) {
+		switch {
+		case jErr.Code == jsonrpc.ErrorCodeJsonParse,
+			jErr.Code == jsonrpc.ErrorCodeInvalidRequest,
+			jErr.Code == jsonrpc.ErrorCodeInvalidParams:
+			return ErrInvalidParams
+		case jErr.Code == jsonrpc.ErrorCodeMethodNotFound:
+			return ErrMethodNotFound
+		case jErr.Code == jsonrpc.ErrorCodeNotFound:
+			return ErrNotFound
+		case jErr.Code == jsonrpc.ErrorCodePending:
+			return ErrPending
+		case jErr.Code == jsonrpc.ErrorCodeExecuting:
+			return ErrExecuting
+		case jErr.Code == jsonrpc.ErrorCodeTimeout,
+			jErr.Code == jsonrpc.ErrorCodeSystemTimeout:
+			return ErrTimeout
+		case jErr.Code <= jsonrpc.ErrorCodeScore && jErr.Code > jsonrpc.ErrorCodeSystem:
+			return ErrScore
+		default:
+			return ErrServer
+		}
+	}
+
+	var hErr *HttpError
+	if errors.As(err, &hErr) {
+		return ErrHTTP
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || IsRetriable(err) {
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"sync"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// AnyScore registers an event decoder for events emitted by any SCORE.
+const AnyScore = "*"
+
+// EventContext is what event decoders know about the transaction which
+// emitted an event.
+type EventContext struct {
+	// From is the sender of the transaction, or the system SCORE for
+	// the base transaction.
+	From string
+
+	// To is the receiver of the transaction.
+	To string
+
+	// Tokens are the IRC2 tokens whose transfers are decoded.
+	Tokens *TokenRegistry
+}
+
+// EventDecoder decodes an event log into operations numbered after
+// lastOpIndex. It returns no operation for a log it does not trust, and
+// an error wrapping ErrMalformedEvent for a log it can not decode.
+type EventDecoder func(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error)
+
+type eventKey struct {
+	score     string
+	signature string
+}
+
+var (
+	eventDecodersMtx sync.RWMutex
+	eventDecoders    = map[eventKey]EventDecoder{}
+)
+
+// RegisterEventDecoder decodes the events with signature emitted by the
+// SCORE at score, or by any SCORE for AnyScore, with decoder. A decoder
+// registered for a SCORE takes precedence over one for AnyScore.
+func RegisterEventDecoder(score string, signature string, decoder EventDecoder) {
+	eventDecodersMtx.Lock()
+	defer eventDecodersMtx.Unlock()
+	eventDecoders[eventKey{score, signature}] = decoder
+}
+
+func lookupEventDecoder(score string, signature string) (EventDecoder, bool) {
+	eventDecodersMtx.RLock()
+	defer eventDecodersMtx.RUnlock()
+	if decoder, ok := eventDecoders[eventKey{score, signature}]; ok {
+		return decoder, true
+	}
+	decoder, ok := eventDecoders[eventKey{AnyScore, signature}]
+	return decoder, ok
+}
+
+// Issuance, claims and burns only move ICX when the system SCORE emits
+// them. ICON 1 networks burn ICX through the governance SCORE as well.
+func init() {
+	RegisterEventDecoder(SystemScoreAddress, issueSig, decodeIssue)
+	for _, sig := range []string{claimSig, claimSig2} {
+		RegisterEventDecoder(SystemScoreAddress, sig, decodeClaim)
+	}
+	for _, sig := range []string{burnSig1, burnSig2, burnSig3} {
+		RegisterEventDecoder(SystemScoreAddress, sig, decodeBurn)
+	}
+	for _, sig := range []string{burnSig1, burnSig2} {
+		RegisterEventDecoder(GovernanceScoreAddress, sig, decodeBurn)
+	}
+	RegisterEventDecoder(AnyScore, icxTransferSig, decodeICXTransfer)
+	RegisterEventDecoder(AnyScore, depositWithdrawn, decodeDepositWithdrawn)
+	RegisterEventDecoder(AnyScore, irc2TransferSig, decodeTokenTransfer)
+	for _, sig := range []string{irc3TransferSig, irc31SingleSig, irc31BatchSig} {
+		RegisterEventDecoder(AnyScore, sig, decodeNFTTransfer)
+	}
+}
+
+func decodeIssue(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	op, err := getIssueOps(el, lastOpIndex)
+	if err != nil {
+		return nil, err
+	}
+	return []*types.Operation{op}, nil
+}
+
+func decodeClaim(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	return getClaimOps(ec.From, el, lastOpIndex)
+}
+
+func decodeBurn(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	op, err := getBurnOps(el, lastOpIndex)
+	if err != nil {
+		return nil, err
+	}
+	return []*types.Operation{op}, nil
+}
+
+// decodeICXTransfer decodes the transfers of ICX by a contract. The node
+// logs them under the address of the contract sending the ICX, so a log
+// moving the ICX of another account than its emitter can only come from
+// a contract faking the event, and is skipped.
+func decodeICXTransfer(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	ops, err := getICXTransferOps(el, lastOpIndex)
+	if err != nil {
+		return nil, err
+	}
+	if ops[0].Account.Address != el.Addr {
+		return nil, nil
+	}
+	return ops, nil
+}
+
+// decodeDepositWithdrawn decodes the withdrawal of a deposit. A deposit
+// is withdrawn by a transaction to the SCORE holding it, and the node logs
+// the withdrawal under the address of that SCORE, so a log emitted by any
+// other SCORE can only be a fake and is skipped.
+func decodeDepositWithdrawn(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	if el.Addr != ec.To {
+		return nil, nil
+	}
+	op, err := getDepositWithdrawn(el, lastOpIndex)
+	if err != nil {
+		return nil, err
+	}
+	return []*types.Operation{op}, nil
+}
+
+func decodeTokenTransfer(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	currency, ok := ec.Tokens.Currency(el.Addr)
+	if !ok {
+		return nil, nil
+	}
+	return getTokenTransferOps(el, currency, lastOpIndex)
+}
+
+func decodeNFTTransfer(ec *EventContext, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	return getNFTTransferOps(el, lastOpIndex)
+}
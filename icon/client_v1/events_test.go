@@ -0,0 +1,119 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestEventEmitters(t *testing.T) {
+	icxTransfer := func(from string) []string {
+		return []string{icxTransferSig, from, testReceiver, "0x10"}
+	}
+	tests := []struct {
+		name    string
+		emitter string
+		indexed []string
+		data    []string
+		ops     []string
+	}{
+		{
+			name:    "icx transfer by its emitter",
+			emitter: testContract,
+			indexed: icxTransfer(testContract),
+			ops:     []string{ICXTransferOpType, ICXTransferOpType},
+		},
+		{
+			name:    "icx transfer of another contract",
+			emitter: testToken,
+			indexed: icxTransfer(testContract),
+		},
+		{
+			name:    "icx transfer of the sender by a contract",
+			emitter: testContract,
+			indexed: icxTransfer(testSender),
+		},
+		{
+			name:    "deposit withdrawn by the receiver of the transaction",
+			emitter: testContract,
+			indexed: []string{depositWithdrawn, "0x12", testSender},
+			data:    []string{"0x10", "0x0"},
+			ops:     []string{WithdrawnType},
+		},
+		{
+			name:    "deposit withdrawn by another contract",
+			emitter: testToken,
+			indexed: []string{depositWithdrawn, "0x12", testSender},
+			data:    []string{"0x10", "0x0"},
+		},
+		{
+			name:    "issue by the system score",
+			emitter: SystemScoreAddress,
+			indexed: []string{issueSig},
+			data:    []string{"0x1", "0x2", "0x3", "0x4"},
+			ops:     []string{IssueOpType},
+		},
+		{
+			name:    "issue by a contract",
+			emitter: testContract,
+			indexed: []string{issueSig},
+			data:    []string{"0x1", "0x2", "0x3", "0x4"},
+		},
+		{
+			name:    "burn by the governance score",
+			emitter: GovernanceScoreAddress,
+			indexed: []string{burnSig2},
+			data:    []string{"0x10", "0x20"},
+			ops:     []string{BurnOpType},
+		},
+		{
+			name:    "burn by a contract",
+			emitter: testContract,
+			indexed: []string{burnSig2},
+			data:    []string{"0x10", "0x20"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			el := map[string]interface{}{
+				"scoreAddress": test.emitter,
+				"indexed":      test.indexed,
+				"data":         test.data,
+			}
+			b, err := json.Marshal(el)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var els []*EventLog
+			if err := json.Unmarshal(append(append([]byte("["), b...), ']'), &els); err != nil {
+				t.Fatal(err)
+			}
+
+			// The transaction is sent by testSender to testContract.
+			ops := GetOperations(testEventContext(), els, 3)
+			if len(ops) != len(test.ops) {
+				t.Fatalf("%d operations, want %v: %s", len(ops), test.ops, types.PrettyPrintStruct(ops))
+			}
+			for i, op := range ops {
+				if op.Type != test.ops[i] {
+					t.Fatalf("operation %d is %s, want %s", i, op.Type, test.ops[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/icon-project/goloop/server/jsonrpc"
+)
+
+// Fixture is a recorded JSON-RPC call. Fixtures are stored one per file,
+// named after the method and a digest of the params.
+type Fixture struct {
+	Method     string          `json:"method"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	StatusCode int             `json:"status"`
+	Response   json.RawMessage `json:"response"`
+}
+
+// FixtureKey returns the file name a call of method with params is
+// stored under. Params are compared by value, so the formatting and the
+// key order of the request do not matter.
+func FixtureKey(method string, params json.RawMessage) string {
+	canonical := []byte("null")
+	if len(params) > 0 {
+		var v interface{}
+		if err := json.Unmarshal(params, &v); err == nil {
+			canonical, _ = json.Marshal(v)
+		} else {
+			canonical = params
+		}
+	}
+	sum := sha256.Sum256(canonical)
+	return method + "-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// RecordTransport is an http.RoundTripper which forwards requests to Base
+// and stores every JSON-RPC call with its response as a Fixture in Dir.
+type RecordTransport struct {
+	Base http.RoundTripper
+	Dir  string
+}
+
+func NewRecordTransport(dir string) *RecordTransport {
+	return &RecordTransport{Base: http.DefaultTransport, Dir: dir}
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqB, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respB, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respB))
+
+	if err := t.record(reqB, resp.StatusCode, respB); err != nil {
+		return nil, fmt.Errorf("%w: unable to record fixture", err)
+	}
+	return resp, nil
+}
+
+func (t *RecordTransport) record(reqB []byte, status int, respB []byte) error {
+	reqs, batch, err := decodeRequests(reqB)
+	if err != nil {
+		return err
+	}
+
+	// Single calls are stored as they are. The elements of a batch are
+	// split up, so that they can be replayed in any combination.
+	resps := map[string]json.RawMessage{}
+	if batch {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(respB, &elems); err != nil {
+			return err
+		}
+		for _, elem := range elems {
+			var r struct {
+				ID json.RawMessage `json:"id"`
+			}
+			if err := json.Unmarshal(elem, &r); err != nil {
+				return err
+			}
+			resps[string(r.ID)] = elem
+		}
+	}
+
+	for _, r := range reqs {
+		f := &Fixture{
+			Method:     r.Method,
+			Params:     r.Params,
+			StatusCode: status,
+			Response:   respB,
+		}
+		if batch {
+			id, _ := json.Marshal(r.ID)
+			resp, ok := resps[string(id)]
+			if !ok {
+				continue
+			}
+			f.StatusCode = http.StatusOK
+			f.Response = resp
+		}
+		if err := writeFixture(t.Dir, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplayTransport is an http.RoundTripper which answers JSON-RPC requests
+// from the fixtures in Dir, without any network access.
+type ReplayTransport struct {
+	Dir string
+}
+
+func NewReplayTransport(dir string) *ReplayTransport {
+	return &ReplayTransport{Dir: dir}
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqB, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	reqs, batch, err := decodeRequests(reqB)
+	if err != nil {
+		return nil, err
+	}
+
+	status := http.StatusOK
+	resps := make([]json.RawMessage, len(reqs))
+	for i, r := range reqs {
+		f, err := readFixture(t.Dir, r.Method, r.Params)
+		if err != nil {
+			return nil, err
+		}
+		if resps[i], err = withID(f.Response, r.ID); err != nil {
+			return nil, err
+		}
+		status = f.StatusCode
+	}
+
+	var body []byte
+	if batch {
+		status = http.StatusOK
+		body, err = json.Marshal(resps)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		body = resps[0]
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{headerContentType: []string{typeApplicationJSON}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// withID replaces the id of a recorded response with the id of the
+// request being replayed.
+func withID(resp json.RawMessage, id interface{}) (json.RawMessage, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(resp, &m); err != nil {
+		return nil, err
+	}
+	idB, err := json.Marshal(id)
+	if err != nil {
+		return nil, err
+	}
+	m["id"] = idB
+	return json.Marshal(m)
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func decodeRequests(b []byte) ([]*jsonrpc.Request, bool, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+		var reqs []*jsonrpc.Request
+		if err := json.Unmarshal(b, &reqs); err != nil {
+			return nil, true, err
+		}
+		return reqs, true, nil
+	}
+	req := new(jsonrpc.Request)
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, false, err
+	}
+	return []*jsonrpc.Request{req}, false, nil
+}
+
+func writeFixture(dir string, f *Fixture) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, FixtureKey(f.Method, f.Params))
+	tmp, err := ioutil.TempFile(dir, ".fixture-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readFixture(dir string, method string, params json.RawMessage) (*Fixture, error) {
+	path := filepath.Join(dir, FixtureKey(method, params))
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no fixture for %s %s", err, method, string(params))
+	}
+	f := new(Fixture)
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("%w: invalid fixture %s", err, path)
+	}
+	return f, nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/icon-project/goloop/server/jsonrpc"
+)
+
+// echoServer answers every call with its method and params, one response
+// per call of a batch.
+func echoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs, batch, err := decodeRequests(b)
+		if err != nil {
+			t.Errorf("invalid request %s: %v", b, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resps []interface{}
+		for _, req := range reqs {
+			resps = append(resps, map[string]interface{}{
+				"jsonrpc": jsonrpc.Version,
+				"id":      req.ID,
+				"result":  map[string]interface{}{"method": req.Method, "params": req.Params},
+			})
+		}
+		w.Header().Set(headerContentType, typeApplicationJSON)
+		if batch {
+			_ = json.NewEncoder(w).Encode(resps)
+		} else {
+			_ = json.NewEncoder(w).Encode(resps[0])
+		}
+	}))
+}
+
+func newFixtureClient(endpoint string, rt http.RoundTripper) *JsonRpcClient {
+	c := NewJsonRpcClient(new(http.Client), endpoint)
+	c.SetTransport(rt)
+	c.Retry = NewRetryPolicy(1, 0)
+	return c
+}
+
+type echoResult struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+func TestFixtureRecordReplay(t *testing.T) {
+	srv := echoServer(t)
+	dir := t.TempDir()
+	params := &BlockRPCRequest{Height: "0x2"}
+
+	var recorded echoResult
+	rec := newFixtureClient(srv.URL, NewRecordTransport(dir))
+	if _, err := rec.Do(context.Background(), "icx_getBlock", params, &recorded); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, FixtureKey("icx_getBlock", recorded.Params))); err != nil {
+		t.Fatalf("fixture not stored: %v", err)
+	}
+
+	var replayed echoResult
+	rep := newFixtureClient(srv.URL, NewReplayTransport(dir))
+	if _, err := rep.Do(context.Background(), "icx_getBlock", params, &replayed); err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Method != "icx_getBlock" || !bytes.Equal(replayed.Params, recorded.Params) {
+		t.Fatalf("replayed %+v, recorded %+v", replayed, recorded)
+	}
+}
+
+func TestFixtureBatchSplit(t *testing.T) {
+	srv := echoServer(t)
+	defer srv.Close()
+	dir := t.TempDir()
+	params := &BlockRPCRequest{Height: "0x5"}
+
+	rec := newFixtureClient(srv.URL, NewRecordTransport(dir))
+	var block, receipts echoResult
+	err := rec.DoBatch(context.Background(), []*BatchElem{
+		{Method: "icx_getBlock", Params: params, Result: &block},
+		{Method: "icx_getBlockReceipts", Params: params, Result: &receipts},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each call of the batch is stored on its own, with its own response.
+	for _, method := range []string{"icx_getBlock", "icx_getBlockReceipts"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, FixtureKey(method, block.Params)))
+		if err != nil {
+			t.Fatalf("%s not stored: %v", method, err)
+		}
+		f := new(Fixture)
+		if err := json.Unmarshal(b, f); err != nil {
+			t.Fatal(err)
+		}
+		if f.Method != method || f.StatusCode != http.StatusOK {
+			t.Fatalf("fixture of %s is %s with status %d", method, f.Method, f.StatusCode)
+		}
+		if strings.HasPrefix(strings.TrimSpace(string(f.Response)), "[") {
+			t.Fatalf("fixture of %s holds the whole batch", method)
+		}
+	}
+
+	// The calls replay alone, and in a batch of another order.
+	rep := newFixtureClient(srv.URL, NewReplayTransport(dir))
+	var single echoResult
+	if _, err := rep.Do(context.Background(), "icx_getBlockReceipts", params, &single); err != nil {
+		t.Fatal(err)
+	}
+	if single.Method != "icx_getBlockReceipts" {
+		t.Fatalf("replayed %s", single.Method)
+	}
+	var block2, receipts2 echoResult
+	err = rep.DoBatch(context.Background(), []*BatchElem{
+		{Method: "icx_getBlockReceipts", Params: params, Result: &receipts2},
+		{Method: "icx_getBlock", Params: params, Result: &block2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block2.Method != "icx_getBlock" || receipts2.Method != "icx_getBlockReceipts" {
+		t.Fatalf("replayed %s and %s", block2.Method, receipts2.Method)
+	}
+}
+
+func TestFixtureKeyIgnoresFormatting(t *testing.T) {
+	a := FixtureKey("icx_call", json.RawMessage(`{"to":"cx0","data":{"method":"m"}}`))
+	b := FixtureKey("icx_call", json.RawMessage(`{ "data": {"method": "m"}, "to": "cx0" }`))
+	if a != b {
+		t.Fatalf("keys differ: %s %s", a, b)
+	}
+	if c := FixtureKey("icx_getBlock", nil); c == FixtureKey("icx_getBlock", json.RawMessage(`{}`)) {
+		t.Fatalf("absent and empty params share key %s", c)
+	}
+}
+
+func TestFixtureReplayID(t *testing.T) {
+	dir := t.TempDir()
+	err := writeFixture(dir, &Fixture{
+		Method:     "icx_getLastBlock",
+		StatusCode: http.StatusOK,
+		Response:   json.RawMessage(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc := &http.Client{Transport: NewReplayTransport(dir)}
+	for _, id := range []string{`7`, `"abc"`, `1607000000000`} {
+		body := `{"jsonrpc":"2.0","id":` + id + `,"method":"icx_getLastBlock"}`
+		resp, err := hc.Post("http://replay", typeApplicationJSON, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r struct {
+			ID     json.RawMessage `json:"id"`
+			Result string          `json:"result"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&r)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(r.ID) != id || r.Result != "0x1" {
+			t.Fatalf("request id %s replayed as id %s result %s", id, r.ID, r.Result)
+		}
+	}
+}
+
+func TestFixtureReplayMiss(t *testing.T) {
+	rep := newFixtureClient("http://replay", NewReplayTransport(t.TempDir()))
+	var result echoResult
+	_, err := rep.Do(context.Background(), "icx_getBlock", &BlockRPCRequest{Height: "0x9"}, &result)
+	if err == nil || !strings.Contains(err.Error(), "no fixture for icx_getBlock") {
+		t.Fatalf("expected a missing fixture, got %v", err)
+	}
+}
@@ -16,6 +16,7 @@ package client_v1
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -37,6 +38,10 @@ type JsonRpcClient struct {
 	Endpoint     string
 	CustomHeader map[string]string
 	Pre          func(req *http.Request) error
+	Retry        *RetryPolicy
+
+	// noBatch is set once the node rejected a batch request.
+	noBatch int32
 }
 
 type Response struct {
@@ -47,8 +52,9 @@ type Response struct {
 }
 
 type HttpError struct {
-	response string
-	message  string
+	StatusCode int
+	response   string
+	message    string
 }
 
 func (e *HttpError) Error() string {
@@ -67,13 +73,25 @@ func NewHttpError(r *http.Response) error {
 		response = string(rb)
 	}
 	return &HttpError{
-		message:  "HTTP " + r.Status,
-		response: response,
+		StatusCode: r.StatusCode,
+		message:    "HTTP " + r.Status,
+		response:   response,
 	}
 }
 
 func NewJsonRpcClient(hc *http.Client, endpoint string) *JsonRpcClient {
-	return &JsonRpcClient{hc: hc, Endpoint: endpoint, CustomHeader: make(map[string]string)}
+	return &JsonRpcClient{
+		hc:           hc,
+		Endpoint:     endpoint,
+		CustomHeader: make(map[string]string),
+		Retry:        DefaultRetryPolicy(),
+	}
+}
+
+// SetTransport replaces the transport requests are sent with, for example
+// with a RecordTransport or a ReplayTransport.
+func (c *JsonRpcClient) SetTransport(rt http.RoundTripper) {
+	c.hc.Transport = rt
 }
 
 func (c *JsonRpcClient) _do(req *http.Request) (resp *http.Response, err error) {
@@ -93,11 +111,21 @@ func (c *JsonRpcClient) _do(req *http.Request) (resp *http.Response, err error)
 	return
 }
 
-func (c *JsonRpcClient) Do(method string, reqPtr, respPtr interface{}) (jrResp *Response, err error) {
-	return c.DoURL(c.Endpoint, method, reqPtr, respPtr)
+// Do sends a JSON-RPC request to the default endpoint. The request is
+// bound to ctx, so cancelling ctx aborts the in-flight HTTP call.
+func (c *JsonRpcClient) Do(ctx context.Context, method string, reqPtr, respPtr interface{}) (jrResp *Response, err error) {
+	return c.DoURL(ctx, c.Endpoint, method, reqPtr, respPtr)
 }
 
-func (c *JsonRpcClient) DoURL(url string, method string, reqPtr, respPtr interface{}) (jrResp *Response, err error) {
+// DoURL sends a JSON-RPC request to url. The request is bound to ctx,
+// so cancelling ctx aborts the in-flight HTTP call. Failed requests are
+// sent again according to c.Retry, and the final failure is returned as
+// a *NodeError when its kind is known.
+func (c *JsonRpcClient) DoURL(ctx context.Context, url string, method string, reqPtr, respPtr interface{}) (jrResp *Response, err error) {
+	defer func() {
+		err = newNodeError(method, err)
+	}()
+
 	jrReq := &jsonrpc.Request{
 		ID:      time.Now().UnixNano() / int64(time.Millisecond),
 		Version: jsonrpc.Version,
@@ -115,7 +143,19 @@ func (c *JsonRpcClient) DoURL(url string, method string, reqPtr, respPtr interfa
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewReader(reqB))
+	for attempt := 1; ; attempt++ {
+		jrResp, err = c.post(ctx, url, reqB, respPtr)
+		if err == nil || !c.Retry.ShouldRetry(method, attempt, err) {
+			return
+		}
+		if wErr := c.Retry.wait(ctx, attempt); wErr != nil {
+			return
+		}
+	}
+}
+
+func (c *JsonRpcClient) post(ctx context.Context, url string, reqB []byte, respPtr interface{}) (jrResp *Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqB))
 	if err != nil {
 		return
 	}
@@ -130,7 +170,8 @@ func (c *JsonRpcClient) DoURL(url string, method string, reqPtr, respPtr interfa
 	if err != nil {
 		if resp != nil {
 			if ct, _, mErr := mime.ParseMediaType(resp.Header.Get(headerContentType)); mErr != nil {
-				err = mErr
+				err = NewHttpError(resp)
+				resp.Body.Close()
 				return
 			} else if ct == typeApplicationJSON {
 				if jrResp, dErr = decodeResponseBody(resp); dErr != nil {
@@ -139,9 +180,14 @@ func (c *JsonRpcClient) DoURL(url string, method string, reqPtr, respPtr interfa
 				}
 			} else {
 				err = NewHttpError(resp)
+				resp.Body.Close()
 				return
 			}
-			err = jrResp.Error
+			if jrResp.Error != nil {
+				err = jrResp.Error
+			} else {
+				err = &HttpError{StatusCode: resp.StatusCode, message: "HTTP " + resp.Status}
+			}
 			return
 		}
 		return
@@ -165,8 +211,8 @@ func (c *JsonRpcClient) DoURL(url string, method string, reqPtr, respPtr interfa
 	return
 }
 
-func (c *JsonRpcClient) Raw(reqB []byte) (resp *http.Response, err error) {
-	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewReader(reqB))
+func (c *JsonRpcClient) Raw(ctx context.Context, reqB []byte) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewReader(reqB))
 	if err != nil {
 		return
 	}
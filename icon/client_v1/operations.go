@@ -1,8 +1,14 @@
 package client_v1
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/common/codec"
+	"log"
 	"math/big"
+	"strings"
 )
 
 const (
@@ -14,8 +20,16 @@ const (
 	burnSig2         = "ICXBurned(int)"
 	burnSig3         = "ICXBurnedV2(Address,int,int)"
 	depositWithdrawn = "DepositWithdrawn(bytes,Address,int,int)"
+	irc2TransferSig  = "Transfer(Address,Address,int,bytes)"
+	irc3TransferSig  = "Transfer(Address,Address,int)"
+	irc31SingleSig   = "TransferSingle(Address,Address,Address,int,int)"
+	irc31BatchSig    = "TransferBatch(Address,Address,Address,bytes,bytes)"
 )
 
+// ErrMalformedEvent is returned by event decoders for an event log whose
+// arguments do not have the shape of its signature.
+var ErrMalformedEvent = errors.New("malformed event log")
+
 func ParseGenesisOperationsV2(tx GenesisTransaction) ([]*types.Operation, error) {
 	var ops []*types.Operation
 	for _, account := range tx.Accounts {
@@ -253,98 +267,188 @@ func MakeBaseOperations() (*types.Operation, error) {
 	return baseOp, nil
 }
 
-func GetOperations(fa string, els []*EventLog, lastOpIndex int64) []*types.Operation {
+// GetOperations decodes the event logs of a transaction into operations
+// numbered after lastOpIndex, with the decoders registered for the SCORE
+// and the signature of every log. Logs without a decoder are skipped, and
+// so are malformed logs, with a warning.
+func GetOperations(ec *EventContext, els []*EventLog, lastOpIndex int64) []*types.Operation {
 	ops := make([]*types.Operation, 0)
 	for _, el := range els {
-		switch *el.Indexed[0] {
-		case icxTransferSig:
-			value := new(big.Int)
-			value.SetString((*el.Indexed[3])[2:], 16)
-			ops = append(ops, &types.Operation{
-				OperationIdentifier: &types.OperationIdentifier{
-					Index: lastOpIndex + 1,
-				},
-				Type:   ICXTransferOpType,
-				Status: SuccessStatus,
-				Account: &types.AccountIdentifier{
-					Address: *el.Indexed[1],
-				},
-				Amount: &types.Amount{
-					Value:    "-" + value.Text(10),
-					Currency: ICXCurrency,
-				},
-			})
-			lastOpIndex += 1
-			ops = append(ops, &types.Operation{
-				OperationIdentifier: &types.OperationIdentifier{
-					Index: lastOpIndex + 1,
-				},
-				RelatedOperations: []*types.OperationIdentifier{
-					{
-						Index: lastOpIndex,
-					},
-				},
-				Type:   ICXTransferOpType,
-				Status: SuccessStatus,
-				Account: &types.AccountIdentifier{
-					Address: *el.Indexed[2],
-				},
-				Amount: &types.Amount{
-					Value:    value.Text(10),
-					Currency: ICXCurrency,
-				},
-			})
-			lastOpIndex += 1
-		case issueSig:
-			value := new(big.Int)
-			value.SetString((*el.Data[2])[2:], 16)
-			ops = append(ops, &types.Operation{
-				OperationIdentifier: &types.OperationIdentifier{
-					Index: lastOpIndex + 1,
-				},
-				Type:   IssueOpType,
-				Status: SuccessStatus,
-				Account: &types.AccountIdentifier{
-					Address: TreasuryAddress,
-				},
-				Amount: &types.Amount{
-					Value:    value.Text(10),
-					Currency: ICXCurrency,
-				},
-			})
-			lastOpIndex += 1
-		case claimSig:
-			op := getClaimOps(fa, el, lastOpIndex)
-			ops = append(ops, op...)
-			lastOpIndex += 2
-		case claimSig2:
-			op := getClaimOps(fa, el, lastOpIndex)
-			ops = append(ops, op...)
-			lastOpIndex += 2
-		case burnSig1:
-			op := getBurnOps(el, lastOpIndex)
-			ops = append(ops, op)
-			lastOpIndex += 1
-		case burnSig2:
-			op := getBurnOps(el, lastOpIndex)
-			ops = append(ops, op)
-			lastOpIndex += 1
-		case burnSig3:
-			op := getBurnOps(el, lastOpIndex)
-			ops = append(ops, op)
-			lastOpIndex += 1
-		case depositWithdrawn:
-			op := getDepositWithdrawn(el, lastOpIndex)
-			ops = append(ops, op)
-			lastOpIndex += 1
+		if el == nil || len(el.Indexed) == 0 || el.Indexed[0] == nil {
+			log.Printf("skipping event log without signature")
+			continue
 		}
+		decoder, ok := lookupEventDecoder(el.Addr, *el.Indexed[0])
+		if !ok {
+			continue
+		}
+		op, err := decoder(ec, el, lastOpIndex)
+		if err != nil {
+			log.Printf("skipping event %s of %s: %v", *el.Indexed[0], el.Addr, err)
+			continue
+		}
+		ops = append(ops, op...)
+		lastOpIndex += int64(len(op))
 	}
 	return ops
 }
 
-func getClaimOps(fa string, el *EventLog, lastOpIndex int64) []*types.Operation {
-	value := new(big.Int)
-	value.SetString((*el.Data[1])[2:], 16)
+// eventArgs returns the arguments of el after its signature, checking
+// that el has indexed indexed arguments, counting the signature, and at
+// least data data arguments, none of them null.
+func eventArgs(el *EventLog, indexed int, data int) ([]string, error) {
+	if len(el.Indexed) != indexed || len(el.Data) < data {
+		return nil, fmt.Errorf("%w: %d indexed and %d data arguments, expected %d and %d",
+			ErrMalformedEvent, len(el.Indexed), len(el.Data), indexed, data)
+	}
+	args := make([]string, 0, len(el.Indexed)-1+len(el.Data))
+	for _, group := range [][]*string{el.Indexed[1:], el.Data} {
+		for _, arg := range group {
+			if arg == nil {
+				return nil, fmt.Errorf("%w: null argument", ErrMalformedEvent)
+			}
+			args = append(args, *arg)
+		}
+	}
+	return args, nil
+}
+
+// leadingEventArgs returns the first n arguments of el after its
+// signature, whichever of them are indexed, for the events of token
+// standards which leave it to the contract which arguments to index.
+func leadingEventArgs(el *EventLog, n int) ([]string, error) {
+	if len(el.Indexed)-1+len(el.Data) < n {
+		return nil, fmt.Errorf("%w: %d indexed and %d data arguments, expected %d in all",
+			ErrMalformedEvent, len(el.Indexed), len(el.Data), n+1)
+	}
+	args := make([]string, 0, n)
+	for _, group := range [][]*string{el.Indexed[1:], el.Data} {
+		for _, arg := range group {
+			if len(args) == n {
+				return args, nil
+			}
+			if arg == nil {
+				return nil, fmt.Errorf("%w: null argument", ErrMalformedEvent)
+			}
+			args = append(args, *arg)
+		}
+	}
+	return args, nil
+}
+
+// hexArg parses the integer argument at i of args.
+func hexArg(args []string, i int) (*big.Int, error) {
+	value, ok := parseHexInt(args[i])
+	if !ok {
+		return nil, fmt.Errorf("%w: argument %d %q is not a hex integer", ErrMalformedEvent, i, args[i])
+	}
+	return value, nil
+}
+
+// addressArg checks the address argument at i of args.
+func addressArg(args []string, i int) (string, error) {
+	if !isAddress(args[i]) {
+		return "", fmt.Errorf("%w: argument %d %q is not an address", ErrMalformedEvent, i, args[i])
+	}
+	return args[i], nil
+}
+
+func getICXTransferOps(el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	args, err := eventArgs(el, 4, 0)
+	if err != nil {
+		return nil, err
+	}
+	from, err := addressArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := addressArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	value, err := hexArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]*types.Operation, 0)
+	ops = append(ops, &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: lastOpIndex + 1,
+		},
+		Type:   ICXTransferOpType,
+		Status: SuccessStatus,
+		Account: &types.AccountIdentifier{
+			Address: from,
+		},
+		Amount: &types.Amount{
+			Value:    "-" + value.Text(10),
+			Currency: ICXCurrency,
+		},
+	})
+	lastOpIndex += 1
+	ops = append(ops, &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: lastOpIndex + 1,
+		},
+		RelatedOperations: []*types.OperationIdentifier{
+			{
+				Index: lastOpIndex,
+			},
+		},
+		Type:   ICXTransferOpType,
+		Status: SuccessStatus,
+		Account: &types.AccountIdentifier{
+			Address: to,
+		},
+		Amount: &types.Amount{
+			Value:    value.Text(10),
+			Currency: ICXCurrency,
+		},
+	})
+	return ops, nil
+}
+
+func getIssueOps(el *EventLog, lastOpIndex int64) (*types.Operation, error) {
+	args, err := eventArgs(el, 1, 4)
+	if err != nil {
+		return nil, err
+	}
+	value, err := hexArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	op := &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: lastOpIndex + 1,
+		},
+		Type:   IssueOpType,
+		Status: SuccessStatus,
+		Account: &types.AccountIdentifier{
+			Address: TreasuryAddress,
+		},
+		Amount: &types.Amount{
+			Value:    value.Text(10),
+			Currency: ICXCurrency,
+		},
+	}
+	return op, nil
+}
+
+// getClaimOps returns the ICX of a claimed I-Score moving from the
+// treasury to fa. IScoreClaimedV2 indexes the claiming address.
+func getClaimOps(fa string, el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	indexed := 1
+	if *el.Indexed[0] == claimSig2 {
+		indexed = 2
+	}
+	args, err := eventArgs(el, indexed, 2)
+	if err != nil {
+		return nil, err
+	}
+	value, err := hexArg(args, indexed)
+	if err != nil {
+		return nil, err
+	}
 	ops := make([]*types.Operation, 0)
 	ops = append(ops, &types.Operation{
 		OperationIdentifier: &types.OperationIdentifier{
@@ -380,12 +484,24 @@ func getClaimOps(fa string, el *EventLog, lastOpIndex int64) []*types.Operation
 			Currency: ICXCurrency,
 		},
 	})
-	return ops
+	return ops, nil
 }
 
-func getBurnOps(el *EventLog, lastOpIndex int64) *types.Operation {
-	value := new(big.Int)
-	value.SetString((*el.Data[0])[2:], 16)
+// getBurnOps returns the ICX burned by the system SCORE. ICXBurnedV2
+// indexes the address the ICX is burned from.
+func getBurnOps(el *EventLog, lastOpIndex int64) (*types.Operation, error) {
+	indexed := 1
+	if *el.Indexed[0] == burnSig3 {
+		indexed = 2
+	}
+	args, err := eventArgs(el, indexed, 1)
+	if err != nil {
+		return nil, err
+	}
+	value, err := hexArg(args, indexed-1)
+	if err != nil {
+		return nil, err
+	}
 	op := &types.Operation{
 		OperationIdentifier: &types.OperationIdentifier{
 			Index: lastOpIndex + 1,
@@ -400,13 +516,22 @@ func getBurnOps(el *EventLog, lastOpIndex int64) *types.Operation {
 			Currency: ICXCurrency,
 		},
 	}
-	return op
+	return op, nil
 }
 
-func getDepositWithdrawn(el *EventLog, lastOpIndex int64) *types.Operation {
-	value := new(big.Int)
-	value.SetString((*el.Data[0])[2:], 16)
-	fa := *el.Indexed[2]
+func getDepositWithdrawn(el *EventLog, lastOpIndex int64) (*types.Operation, error) {
+	args, err := eventArgs(el, 3, 1)
+	if err != nil {
+		return nil, err
+	}
+	fa, err := addressArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	value, err := hexArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
 	op := &types.Operation{
 		OperationIdentifier: &types.OperationIdentifier{
 			Index: lastOpIndex + 1,
@@ -421,5 +546,213 @@ func getDepositWithdrawn(el *EventLog, lastOpIndex int64) *types.Operation {
 			Currency: ICXCurrency,
 		},
 	}
-	return op
+	return op, nil
+}
+
+// getTokenTransferOps returns the debit and the credit of an IRC2
+// transfer. Tokens index a varying number of the event arguments, so they
+// are read from the indexed and the data arguments in turn.
+func getTokenTransferOps(el *EventLog, currency *types.Currency, lastOpIndex int64) ([]*types.Operation, error) {
+	args, err := leadingEventArgs(el, 3)
+	if err != nil {
+		return nil, err
+	}
+	from, err := addressArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := addressArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	value, err := hexArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]*types.Operation, 0)
+	ops = append(ops, &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: lastOpIndex + 1,
+		},
+		Type:   IRC2TransferOpType,
+		Status: SuccessStatus,
+		Account: &types.AccountIdentifier{
+			Address: from,
+		},
+		Amount: &types.Amount{
+			Value:    new(big.Int).Neg(value).Text(10),
+			Currency: currency,
+		},
+	})
+	lastOpIndex += 1
+	ops = append(ops, &types.Operation{
+		OperationIdentifier: &types.OperationIdentifier{
+			Index: lastOpIndex + 1,
+		},
+		RelatedOperations: []*types.OperationIdentifier{
+			{
+				Index: lastOpIndex,
+			},
+		},
+		Type:   IRC2TransferOpType,
+		Status: SuccessStatus,
+		Account: &types.AccountIdentifier{
+			Address: to,
+		},
+		Amount: &types.Amount{
+			Value:    value.Text(10),
+			Currency: currency,
+		},
+	})
+	return ops, nil
+}
+
+// getNFTTransferOps returns a debit and a credit per token moved by an
+// IRC3 or IRC31 transfer. NFTs are not currencies, so the contract, the
+// token id and the signed amount are in metadata instead of an amount.
+// IRC31 batches carry RLP lists of ids and amounts.
+func getNFTTransferOps(el *EventLog, lastOpIndex int64) ([]*types.Operation, error) {
+	var opType, operator, from, to string
+	var ids, values []*big.Int
+	var args []string
+	var err error
+	switch *el.Indexed[0] {
+	case irc3TransferSig:
+		if args, err = leadingEventArgs(el, 3); err != nil {
+			return nil, err
+		}
+		opType = IRC3TransferOpType
+		id, err := hexArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		ids, values = []*big.Int{id}, []*big.Int{big.NewInt(1)}
+	case irc31SingleSig:
+		if args, err = leadingEventArgs(el, 5); err != nil {
+			return nil, err
+		}
+		opType, operator = IRC31TransferSingleOpType, args[0]
+		args = args[1:]
+		id, err := hexArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		value, err := hexArg(args, 3)
+		if err != nil {
+			return nil, err
+		}
+		ids, values = []*big.Int{id}, []*big.Int{value}
+	case irc31BatchSig:
+		if args, err = leadingEventArgs(el, 5); err != nil {
+			return nil, err
+		}
+		opType, operator = IRC31TransferBatchOpType, args[0]
+		args = args[1:]
+		var ok, ok2 bool
+		ids, ok = parseRLPInts(args[2])
+		values, ok2 = parseRLPInts(args[3])
+		if !ok || !ok2 || len(ids) != len(values) {
+			return nil, fmt.Errorf("%w: ids %q and amounts %q are not RLP lists of the same length",
+				ErrMalformedEvent, args[2], args[3])
+		}
+	default:
+		return nil, nil
+	}
+	if operator != "" && !isAddress(operator) {
+		return nil, fmt.Errorf("%w: operator %q is not an address", ErrMalformedEvent, operator)
+	}
+	if from, err = addressArg(args, 0); err != nil {
+		return nil, err
+	}
+	if to, err = addressArg(args, 1); err != nil {
+		return nil, err
+	}
+
+	ops := make([]*types.Operation, 0)
+	for i, id := range ids {
+		metadata := func(amount *big.Int) map[string]interface{} {
+			m := map[string]interface{}{
+				ContractAddressKey: el.Addr,
+				"token_id":         "0x" + id.Text(16),
+				"amount":           amount.Text(10),
+			}
+			if operator != "" {
+				m["operator"] = operator
+			}
+			return m
+		}
+		ops = append(ops, &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: lastOpIndex + 1,
+			},
+			Type:   opType,
+			Status: SuccessStatus,
+			Account: &types.AccountIdentifier{
+				Address: from,
+			},
+			Metadata: metadata(new(big.Int).Neg(values[i])),
+		})
+		lastOpIndex += 1
+		ops = append(ops, &types.Operation{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: lastOpIndex + 1,
+			},
+			RelatedOperations: []*types.OperationIdentifier{
+				{
+					Index: lastOpIndex,
+				},
+			},
+			Type:   opType,
+			Status: SuccessStatus,
+			Account: &types.AccountIdentifier{
+				Address: to,
+			},
+			Metadata: metadata(values[i]),
+		})
+		lastOpIndex += 1
+	}
+	return ops, nil
+}
+
+// parseHexInt parses a non-negative integer in the 0x prefixed hex format
+// of event arguments.
+func parseHexInt(s string) (*big.Int, bool) {
+	if !strings.HasPrefix(s, "0x") || len(s) == 2 {
+		return nil, false
+	}
+	for _, c := range s[2:] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return nil, false
+		}
+	}
+	return new(big.Int).SetString(s[2:], 16)
+}
+
+// isAddress reports whether s is an account or a contract address.
+func isAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "hx") && !strings.HasPrefix(s, "cx") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+// parseRLPInts decodes the hex encoded RLP list of integers of an IRC31
+// batch.
+func parseRLPInts(s string) ([]*big.Int, bool) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, false
+	}
+	var ints []*big.Int
+	if _, err := codec.RLP.UnmarshalFromBytes(b, &ints); err != nil {
+		return nil, false
+	}
+	for _, v := range ints {
+		if v == nil {
+			return nil, false
+		}
+	}
+	return ints, true
 }
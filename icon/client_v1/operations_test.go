@@ -0,0 +1,193 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	testToken    = "cx1111111111111111111111111111111111111111"
+	testSender   = "hx2222222222222222222222222222222222222222"
+	testReceiver = "hx2222222222222222222222222222222222222223"
+	testContract = "cx3333333333333333333333333333333333333333"
+)
+
+func testEventContext() *EventContext {
+	tokens := NewTokenRegistry(false)
+	tokens.Add(&Token{Address: testToken, Symbol: "TAP", Decimals: 18})
+	return &EventContext{From: testSender, To: testContract, Tokens: tokens}
+}
+
+// checkOperations checks that ops are numbered one after the other from
+// lastOpIndex on, and only relate to operations before them.
+func checkOperations(t *testing.T, ops []*types.Operation, lastOpIndex int64) {
+	t.Helper()
+	for i, op := range ops {
+		index := lastOpIndex + 1 + int64(i)
+		if op == nil || op.OperationIdentifier == nil || op.OperationIdentifier.Index != index {
+			t.Fatalf("operation %d is %s, want index %d", i, types.PrettyPrintStruct(op), index)
+		}
+		for _, related := range op.RelatedOperations {
+			if related.Index <= lastOpIndex || related.Index >= index {
+				t.Fatalf("operation %d relates to operation %d", index, related.Index)
+			}
+		}
+	}
+}
+
+func TestGetOperations(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name   string
+		events string
+		ops    int
+		warn   bool
+	}{
+		{
+			name:   "icx transfer",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `","` + testSender + `","0x10"],"data":[]}]`,
+			ops:    2,
+		},
+		{
+			name:   "icx transfer with data arguments",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `"],"data":["` + testSender + `","0x10"]}]`,
+			warn:   true,
+		},
+		{
+			name:   "icx transfer with fewer indexed arguments",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `","` + testSender + `"],"data":[]}]`,
+			warn:   true,
+		},
+		{
+			name:   "icx transfer on behalf of another account",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testReceiver + `","` + testSender + `","0x10"],"data":[]}]`,
+		},
+		{
+			name:   "user event with a signature of its own",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,int)","` + testSender + `","0x10"],"data":[]}]`,
+		},
+		{
+			name:   "issue",
+			events: `[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["ICXIssued(int,int,int,int)"],"data":["0x1","0x2","0x3","0x4"]}]`,
+			ops:    1,
+		},
+		{
+			name:   "issue with fewer data arguments",
+			events: `[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["ICXIssued(int,int,int,int)"],"data":["0x1"]}]`,
+			warn:   true,
+		},
+		{
+			name:   "issue by another score",
+			events: `[{"scoreAddress":"` + testContract + `","indexed":["ICXIssued(int,int,int,int)"],"data":["0x1","0x2","0x3","0x4"]}]`,
+		},
+		{
+			name:   "value which is not hex",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `","` + testSender + `","0xzz"],"data":[]}]`,
+			warn:   true,
+		},
+		{
+			name:   "short address",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `","hx22","0x10"],"data":[]}]`,
+			warn:   true,
+		},
+		{
+			name:   "null argument",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["Transfer(Address,Address,int,bytes)","` + testSender + `","` + testReceiver + `",null],"data":["0x"]}]`,
+			warn:   true,
+		},
+		{
+			name:   "null argument past the token transfer",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["Transfer(Address,Address,int,bytes)","` + testSender + `","` + testReceiver + `","0x5"],"data":[null]}]`,
+			ops:    2,
+		},
+		{
+			name:   "event logs without signature",
+			events: `[null,{"indexed":[]},{"indexed":[null]}]`,
+			warn:   true,
+		},
+		{
+			name: "token transfer after a skipped event",
+			events: `[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `"],"data":[]},` +
+				`{"scoreAddress":"` + testToken + `","indexed":["Transfer(Address,Address,int,bytes)","` + testSender + `","` + testReceiver + `","0x5"],"data":["0x"]}]`,
+			ops:  2,
+			warn: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var els []*EventLog
+			if err := json.Unmarshal([]byte(test.events), &els); err != nil {
+				t.Fatal(err)
+			}
+			logs.Reset()
+			ops := GetOperations(testEventContext(), els, 3)
+			if len(ops) != test.ops {
+				t.Fatalf("%d operations, want %d: %s", len(ops), test.ops, types.PrettyPrintStruct(ops))
+			}
+			checkOperations(t, ops, 3)
+			if warned := strings.Contains(logs.String(), "skipping event"); warned != test.warn {
+				t.Fatalf("warned %v, want %v: %q", warned, test.warn, logs.String())
+			}
+		})
+	}
+}
+
+func FuzzGetOperations(f *testing.F) {
+	for _, seed := range []string{
+		`[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["ICXIssued(int,int,int,int)"],"data":["0x1","0x2","0x3","0x4"]}]`,
+		`[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["ICXIssued(int,int,int,int)"],"data":["0x1"]}]`,
+		`[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["IScoreClaimedV2(Address,int,int)","` + testSender + `"],"data":["0x1","0x2"]}]`,
+		`[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["IScoreClaimed(int,int)"],"data":[null,"0x"]}]`,
+		`[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["ICXBurnedV2(Address,int,int)","` + testSender + `"],"data":["0x1","0x2"]}]`,
+		`[{"scoreAddress":"cx0000000000000000000000000000000000000000","indexed":["ICXBurned"],"data":[]}]`,
+		`[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `","` + testSender + `","0x10"],"data":[]}]`,
+		`[{"scoreAddress":"` + testToken + `","indexed":["ICXTransfer(Address,Address,int)","` + testToken + `"],"data":["0x1"]}]`,
+		`[{"scoreAddress":"` + testContract + `","indexed":["DepositWithdrawn(bytes,Address,int,int)","0x12","` + testSender + `"],"data":["0x1","0x2"]}]`,
+		`[{"scoreAddress":"` + testToken + `","indexed":["Transfer(Address,Address,int,bytes)","` + testSender + `"],"data":["` + testReceiver + `","0x5",null]}]`,
+		`[{"scoreAddress":"` + testToken + `","indexed":["Transfer(Address,Address,int)","` + testSender + `","` + testReceiver + `","0x5"]}]`,
+		`[{"scoreAddress":"` + testToken + `","indexed":["TransferBatch(Address,Address,Address,bytes,bytes)","` + testSender + `","` + testSender + `","` + testReceiver + `"],"data":["0xc20102","0xc20304"]}]`,
+		`[{"scoreAddress":"` + testToken + `","indexed":["TransferSingle(Address,Address,Address,int,int)"]}]`,
+		`[null,{"indexed":[]},{"indexed":[null]}]`,
+	} {
+		f.Add([]byte(seed), int64(3))
+	}
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ec := testEventContext()
+	f.Fuzz(func(t *testing.T, b []byte, lastOpIndex int64) {
+		var els []*EventLog
+		if json.Unmarshal(b, &els) != nil {
+			return
+		}
+		if lastOpIndex < -1 || lastOpIndex > 1<<40 {
+			return
+		}
+		checkOperations(t, GetOperations(ec, els, lastOpIndex), lastOpIndex)
+	})
+}
@@ -1,29 +1,131 @@
 package client_v1
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/coinbase/rosetta-sdk-go/types"
 )
 
-func ParseBlock(raw map[string]interface{}) (*types.Block, error) {
-	version := raw["version"]
+// BlockDecoder decodes an icx_getBlock result of one block version and
+// converts it to a Rosetta block.
+type BlockDecoder func(raw json.RawMessage) (*types.Block, error)
 
-	switch version {
-	case "0.1a":
-		blk := &Block01a{}
-		if err := UnmarshalJSONMap(raw, blk); err != nil {
-			return nil, err
+var (
+	blockDecodersMtx sync.RWMutex
+	blockDecoders    = map[string]BlockDecoder{}
+)
+
+// RegisterBlockDecoder decodes the blocks of version with decoder. A
+// version such as "2.*" covers every minor version of its major version
+// which has no decoder of its own.
+func RegisterBlockDecoder(version string, decoder BlockDecoder) {
+	blockDecodersMtx.Lock()
+	defer blockDecodersMtx.Unlock()
+	blockDecoders[version] = decoder
+}
+
+func lookupBlockDecoder(version string) (BlockDecoder, bool) {
+	blockDecodersMtx.RLock()
+	defer blockDecodersMtx.RUnlock()
+	if decoder, ok := blockDecoders[version]; ok {
+		return decoder, true
+	}
+	if i := strings.IndexByte(version, '.'); i > 0 {
+		decoder, ok := blockDecoders[version[:i]+".*"]
+		return decoder, ok
+	}
+	return nil, false
+}
+
+// Loopchain nodes of ICON 1 send blocks in the 0.1a format before 0.3 and
+// in the 0.3 format from then on. goloop nodes of ICON 2 send the blocks
+// they produce in the 2.0 format.
+func init() {
+	RegisterBlockDecoder("0.1a", decodeBlock01a)
+	for _, version := range []string{"0.3", "0.4", "0.5"} {
+		RegisterBlockDecoder(version, decodeBlock03)
+	}
+	RegisterBlockDecoder("2.*", decodeBlock20)
+}
+
+func decodeBlock01a(raw json.RawMessage) (*types.Block, error) {
+	blk := &Block01a{}
+	if err := json.Unmarshal(raw, blk); err != nil {
+		return nil, err
+	}
+	return ParseBlock01a(blk)
+}
+
+func decodeBlock03(raw json.RawMessage) (*types.Block, error) {
+	blk := &Block03{}
+	if err := json.Unmarshal(raw, blk); err != nil {
+		return nil, err
+	}
+	return ParseBlock03(blk)
+}
+
+func decodeBlock20(raw json.RawMessage) (*types.Block, error) {
+	blk := &Block20{}
+	if err := json.Unmarshal(raw, blk); err != nil {
+		return nil, err
+	}
+	return ParseBlock20(blk)
+}
+
+// ParseBlock decodes an icx_getBlock result straight into the typed block
+// of its version and converts it to a Rosetta block.
+func ParseBlock(raw json.RawMessage) (*types.Block, error) {
+	version, err := sniffVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, ok := lookupBlockDecoder(version)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported Block Version %s", version)
+	}
+	return decoder(raw)
+}
+
+// sniffVersion returns the top level version field of a block. The node
+// sends it first, so usually only the first key has to be read.
+func sniffVersion(raw json.RawMessage) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil {
+		return "", err
+	} else if t != json.Delim('{') {
+		return "", errors.New("block is not an object")
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return "", err
 		}
-		return ParseBlock01a(blk)
-	case "0.3", "0.4", "0.5":
-		blk := &Block03{}
-		if err := UnmarshalJSONMap(raw, blk); err != nil {
-			return nil, err
+		if t == "version" {
+			var version string
+			if err := dec.Decode(&version); err != nil {
+				return "", err
+			}
+			return version, nil
+		}
+		if err := dec.Decode(&skipValue{}); err != nil {
+			return "", err
 		}
-		return ParseBlock03(blk)
 	}
-	return nil, errors.New("Unsupported Block Version")
+	return "", errors.New("block has no version")
+}
+
+// skipValue consumes a JSON value without decoding it.
+type skipValue struct{}
+
+func (*skipValue) UnmarshalJSON([]byte) error {
+	return nil
 }
 
 func ParseTransactions(txArray []json.RawMessage) ([]*types.Transaction, error) {
@@ -32,48 +134,49 @@ func ParseTransactions(txArray []json.RawMessage) ([]*types.Transaction, error)
 	for _, raw := range txArray {
 		var tx *types.Transaction
 
-		bs, _ := raw.MarshalJSON()
 		transaction := Transaction{}
-		if err := json.Unmarshal(bs, &transaction); err != nil {
+		if err := json.Unmarshal(raw, &transaction); err != nil {
 			return nil, err
 		}
 
+		var err error
 		switch transaction.Version.String() {
 		case "0x3":
-			tx, _ = ParseTransactionV3(transaction)
+			tx, err = ParseTransactionV3(transaction)
 		default:
-			tx, _ = ParseTransactionV2(transaction)
+			tx, err = ParseTransactionV2(transaction)
+		}
+		if err != nil {
+			return nil, err
 		}
 		transactions = append(transactions, tx)
 	}
 	return transactions, nil
 }
 
-func ParseTransactionResults(trsRaws *[]interface{}) ([]*TransactionResult, error) {
-	var trsArray []*TransactionResult
-
-	for _, raw := range *trsRaws {
-		txResult, _ := ParseTransactionResult(raw)
-		trsArray = append(trsArray, txResult)
+// ParseTransactionResults sets the status flag of receipts decoded from
+// icx_getBlockReceipts or icx_getTransactionResult.
+func ParseTransactionResults(trsArray []*TransactionResult) ([]*TransactionResult, error) {
+	for _, txResult := range trsArray {
+		if err := ParseTransactionResult(txResult); err != nil {
+			return nil, err
+		}
 	}
 	return trsArray, nil
 }
 
-func ParseTransactionResult(tx interface{}) (*TransactionResult, error) {
-	bs, _ := json.Marshal(tx)
-	txResult := TransactionResult{}
-	if err := json.Unmarshal(bs, &txResult); err != nil {
-		return nil, err
+func ParseTransactionResult(txResult *TransactionResult) error {
+	if txResult == nil {
+		return errors.New("empty transaction result")
 	}
-	bs, _ = txResult.Status.MarshalJSON()
 	var status string
-	if err := json.Unmarshal(bs, &status); err != nil {
-		return nil, err
+	if err := json.Unmarshal(txResult.Status, &status); err != nil {
+		return err
 	}
 	if status == "0x1" {
 		txResult.StatusFlag = SuccessStatus
 	} else {
 		txResult.StatusFlag = FailureStatus
 	}
-	return &txResult, nil
+	return nil
 }
@@ -0,0 +1,284 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// The block in testdata/block-300tx is a 0.5 block with 300 ICX transfers
+// and the base transaction, recorded with its receipts from the emulator.
+var benchBlockParams = json.RawMessage(`{"height":"0x2"}`)
+
+func benchFixture(tb testing.TB, method string) json.RawMessage {
+	f, err := readFixture(filepath.Join("testdata", "block-300tx"), method, benchBlockParams)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var resp Response
+	if err := json.Unmarshal(f.Response, &resp); err != nil {
+		tb.Fatal(err)
+	}
+	return resp.Result
+}
+
+// parseBlockMap parses a block the way blocks were parsed before they
+// were decoded straight into typed structs: through a generic map, which
+// is encoded again for the typed decoding.
+func parseBlockMap(raw json.RawMessage) (*types.Block, error) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBlock(b)
+}
+
+// parseTransactionResultsMap parses receipts through generic values, one
+// encoding round trip per receipt.
+func parseTransactionResultsMap(raw json.RawMessage) ([]*TransactionResult, error) {
+	var elems []interface{}
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, err
+	}
+	var trsArray []*TransactionResult
+	for _, elem := range elems {
+		b, err := json.Marshal(elem)
+		if err != nil {
+			return nil, err
+		}
+		txResult := &TransactionResult{}
+		if err := json.Unmarshal(b, txResult); err != nil {
+			return nil, err
+		}
+		if err := ParseTransactionResult(txResult); err != nil {
+			return nil, err
+		}
+		trsArray = append(trsArray, txResult)
+	}
+	return trsArray, nil
+}
+
+func parseTransactionResultsTyped(raw json.RawMessage) ([]*TransactionResult, error) {
+	var trsArray []*TransactionResult
+	if err := json.Unmarshal(raw, &trsArray); err != nil {
+		return nil, err
+	}
+	return ParseTransactionResults(trsArray)
+}
+
+func sameJSON(t *testing.T, a interface{}, b interface{}) bool {
+	aB, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bB, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(aB, bB)
+}
+
+func TestParseRecordedBlock(t *testing.T) {
+	blockRaw := benchFixture(t, "icx_getBlock")
+	trsRaw := benchFixture(t, "icx_getBlockReceipts")
+
+	block, err := ParseBlock(blockRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BlockIdentifier.Index != 2 || len(block.Transactions) != 301 {
+		t.Fatalf("block %+v with %d transactions", block.BlockIdentifier, len(block.Transactions))
+	}
+	trsArray, err := parseTransactionResultsTyped(trsRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trsArray) != 301 {
+		t.Fatalf("%d receipts", len(trsArray))
+	}
+
+	// The typed decoding gives the same results as the map round trip, up
+	// to the formatting of the raw values they keep.
+	mapBlock, err := parseBlockMap(blockRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameJSON(t, block, mapBlock) {
+		t.Fatal("typed and map parsing give different blocks")
+	}
+	mapTrsArray, err := parseTransactionResultsMap(trsRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameJSON(t, trsArray, mapTrsArray) {
+		t.Fatal("typed and map parsing give different receipts")
+	}
+
+	c := NewClientV3("http://replay/api/v3")
+	full, err := c.MakeBlockWithReceipts(block, trsArray)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range full.Transactions[1:] {
+		if len(tx.Operations) != 4 || tx.Operations[2].Type != FeeOpType {
+			t.Fatalf("transaction %s has operations %s",
+				tx.TransactionIdentifier.Hash, types.PrettyPrintStruct(tx.Operations))
+		}
+
+		// The steps are decimal, and give the fee charged by the FEE
+		// operations.
+		steps := map[string]*big.Int{}
+		for _, key := range []string{"stepUsed", "stepPrice", "stepLimit"} {
+			value, _ := tx.Metadata[key].(string)
+			step, ok := new(big.Int).SetString(value, 10)
+			if !ok {
+				t.Fatalf("transaction %s has %s %v", tx.TransactionIdentifier.Hash, key, tx.Metadata[key])
+			}
+			steps[key] = step
+		}
+		if steps["stepUsed"].Cmp(steps["stepLimit"]) > 0 {
+			t.Fatalf("transaction %s used %s steps of %s", tx.TransactionIdentifier.Hash, steps["stepUsed"], steps["stepLimit"])
+		}
+		fee := new(big.Int).Mul(steps["stepUsed"], steps["stepPrice"])
+		if tx.Operations[3].Amount.Value != fee.String() {
+			t.Fatalf("transaction %s charged %s, want %s", tx.TransactionIdentifier.Hash, tx.Operations[3].Amount.Value, fee)
+		}
+	}
+}
+
+func BenchmarkParseBlock(b *testing.B) {
+	raw := benchFixture(b, "icx_getBlock")
+	b.Run("typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseBlock(raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := parseBlockMap(raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParseTransactionResults(b *testing.B) {
+	raw := benchFixture(b, "icx_getBlockReceipts")
+	b.Run("typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := parseTransactionResultsTyped(raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := parseTransactionResultsMap(raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// testdata/block-2.0.json is an icx_getBlockByHeight response laid out as
+// goloop encodes ICON 2.0 blocks: hashes without 0x, the height and the
+// timestamp as numbers, and keys in the order goloop writes them. It
+// holds a base transaction, an ICX transfer, a token call and a message.
+func TestParseGoloopBlock(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "block-2.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp Response
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Hash      string `json:"block_hash"`
+		PrevHash  string `json:"prev_block_hash"`
+		Height    int64  `json:"height"`
+		Timestamp int64  `json:"time_stamp"`
+		PeerID    string `json:"peer_id"`
+		Txs       []struct {
+			Hash string `json:"txHash"`
+		} `json:"confirmed_transaction_list"`
+	}
+	if err := json.Unmarshal(resp.Result, &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ParseBlock(resp.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BlockIdentifier.Index != raw.Height || block.BlockIdentifier.Hash != "0x"+raw.Hash {
+		t.Fatalf("block %+v", block.BlockIdentifier)
+	}
+	if block.ParentBlockIdentifier.Index != raw.Height-1 || block.ParentBlockIdentifier.Hash != "0x"+raw.PrevHash {
+		t.Fatalf("parent block %+v", block.ParentBlockIdentifier)
+	}
+	if block.Timestamp != raw.Timestamp/1000 {
+		t.Fatalf("timestamp %d", block.Timestamp)
+	}
+	if block.Metadata["version"] != "2.0" || block.Metadata["peer_id"] != raw.PeerID {
+		t.Fatalf("metadata %s", types.PrettyPrintStruct(block.Metadata))
+	}
+
+	opTypes := [][]string{
+		{BaseOpType},
+		{TransferOpType, TransferOpType, FeeOpType, FeeOpType},
+		{TransferOpType, TransferOpType, FeeOpType, FeeOpType},
+		{TransferOpType, TransferOpType, FeeOpType, FeeOpType},
+	}
+	if len(block.Transactions) != len(opTypes) {
+		t.Fatalf("%d transactions", len(block.Transactions))
+	}
+	for i, tx := range block.Transactions {
+		if tx.TransactionIdentifier.Hash != raw.Txs[i].Hash {
+			t.Fatalf("transaction %d has hash %s, want %s", i, tx.TransactionIdentifier.Hash, raw.Txs[i].Hash)
+		}
+		if len(tx.Operations) != len(opTypes[i]) {
+			t.Fatalf("transaction %d has operations %s", i, types.PrettyPrintStruct(tx.Operations))
+		}
+		for j, op := range tx.Operations {
+			if op.Type != opTypes[i][j] {
+				t.Fatalf("operation %d of transaction %d is %s, want %s", j, i, op.Type, opTypes[i][j])
+			}
+		}
+	}
+	if value := block.Transactions[1].Operations[1].Amount.Value; value != "1000000000000000000" {
+		t.Fatalf("transferred %s", value)
+	}
+	if value := block.Transactions[2].Operations[1].Amount.Value; value != "0" {
+		t.Fatalf("token call transferred %s", value)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/common"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrReceiptMismatch is matched by errors.Is for a ReceiptMismatchError.
+var ErrReceiptMismatch = errors.New("receipts do not match transactions")
+
+// ReceiptMismatchError is returned when the receipts of a block do not
+// pair up with its transactions by hash.
+type ReceiptMismatchError struct {
+	// Block is the block of the transactions, if they are read as part
+	// of one.
+	Block *types.BlockIdentifier
+
+	// Missing are the transactions without a receipt.
+	Missing []string
+
+	// Extra are the receipts of no transaction of the block.
+	Extra []string
+}
+
+func (e *ReceiptMismatchError) Error() string {
+	if e.Block == nil {
+		return fmt.Sprintf("%s: missing %v: extra %v", ErrReceiptMismatch, e.Missing, e.Extra)
+	}
+	return fmt.Sprintf("%s: block %d %s: missing %v: extra %v",
+		ErrReceiptMismatch, e.Block.Index, e.Block.Hash, e.Missing, e.Extra)
+}
+
+func (e *ReceiptMismatchError) Is(target error) bool {
+	return target == ErrReceiptMismatch
+}
+
+// DefaultReceiptWorkers is the default number of icx_getTransactionResult
+// requests sent concurrently for a block whose receipts the node does not
+// serve through icx_getBlockReceipts.
+const DefaultReceiptWorkers = 8
+
+// HasBlockReceipts reports whether icx_getBlockReceipts is used. It is
+// given up on once the node shows that it does not know the method.
+func (c *ClientV3) HasBlockReceipts() bool {
+	return atomic.LoadInt32(&c.noBlockReceipts) == 0
+}
+
+// GetReceipts returns the receipts of block, in the order of its
+// transactions. They are read one transaction at a time when the node
+// can not serve them through icx_getBlockReceipts.
+func (c *ClientV3) GetReceipts(ctx context.Context, block *types.Block) ([]*TransactionResult, error) {
+	if c.HasBlockReceipts() {
+		trsArray, err := c.GetBlockReceipts(ctx, &BlockRPCRequest{Hash: block.BlockIdentifier.Hash})
+		if err == nil || !c.receiptsUnsupported(err) {
+			return trsArray, err
+		}
+	}
+	return c.GetTransactionResults(ctx, block)
+}
+
+// GetTransactionResults reads the receipts of block with one
+// icx_getTransactionResult request per transaction, sending up to
+// ReceiptWorkers of them at a time.
+func (c *ClientV3) GetTransactionResults(ctx context.Context, block *types.Block) ([]*TransactionResult, error) {
+	trsArray := make([]*TransactionResult, len(block.Transactions))
+	if block.BlockIdentifier.Index == GenesisBlockIndex {
+		// The genesis transaction has no receipt to look up by hash.
+		for i := range trsArray {
+			trsArray[i] = genesisReceipt()
+		}
+		return trsArray, nil
+	}
+
+	workers := c.ReceiptWorkers
+	if workers <= 0 {
+		workers = DefaultReceiptWorkers
+	}
+	sem := make(chan struct{}, workers)
+	g, gctx := errgroup.WithContext(ctx)
+	for i, tx := range block.Transactions {
+		i, hash := i, tx.TransactionIdentifier.Hash
+		select {
+		case sem <- struct{}{}:
+		case <-gctx.Done():
+			return nil, g.Wait()
+		}
+		g.Go(func() error {
+			defer func() { <-sem }()
+			txResult, err := c.GetTransactionResult(gctx, &TransactionRPCRequest{Hash: hash})
+			if err != nil {
+				return fmt.Errorf("%w: could not get result of %s", err, hash)
+			}
+			trsArray[i] = txResult
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return trsArray, nil
+}
+
+// receiptsUnsupported reports whether err shows that the node can not
+// serve the receipts of a block through icx_getBlockReceipts, rather than
+// that it failed to serve a request. Nodes which do not know the method
+// are not asked for block receipts again.
+func (c *ClientV3) receiptsUnsupported(err error) bool {
+	if methodMissing(err) {
+		atomic.StoreInt32(&c.noBlockReceipts, 1)
+		return true
+	}
+	// Nodes report the blocks whose receipts they do not keep as not found.
+	// Other failures go through the retry and failover of the request.
+	return errors.Is(err, ErrNotFound)
+}
+
+// genesisReceipt stands in for the receipt of a genesis transaction,
+// which can not be looked up by hash. It gives the block the same
+// operations as the genesis receipts served by icx_getBlockReceipts: a
+// success without fee or event.
+func genesisReceipt() *TransactionResult {
+	status := json.RawMessage(`"0x1"`)
+	return &TransactionResult{
+		StatusFlag:         SuccessStatus,
+		Status:             status,
+		StepUsed:           new(common.HexInt),
+		CumulativeStepUsed: new(common.HexInt),
+		StepPrice:          new(common.HexInt),
+		EventLogs:          []*EventLog{},
+	}
+}
+
+// matchReceipts orders trsArray like the transactions of block, pairing
+// them by hash. The genesis transactions have no hash of their own, so
+// the receipts of the genesis block are only checked to be as many.
+func matchReceipts(block *types.Block, trsArray []*TransactionResult) ([]*TransactionResult, error) {
+	if block.BlockIdentifier.Index == GenesisBlockIndex {
+		if len(trsArray) == len(block.Transactions) {
+			return trsArray, nil
+		}
+		n := len(trsArray)
+		if n > len(block.Transactions) {
+			n = len(block.Transactions)
+		}
+		e := &ReceiptMismatchError{Block: block.BlockIdentifier}
+		for _, tx := range block.Transactions[n:] {
+			e.Missing = append(e.Missing, tx.TransactionIdentifier.Hash)
+		}
+		for _, txResult := range trsArray[n:] {
+			e.Extra = append(e.Extra, txResult.Hash())
+		}
+		return nil, e
+	}
+
+	byHash := make(map[string]*TransactionResult, len(trsArray))
+	var extra []string
+	for _, txResult := range trsArray {
+		hash := NormalizeHash(txResult.Hash())
+		if _, dup := byHash[hash]; dup || hash == "" {
+			extra = append(extra, txResult.Hash())
+			continue
+		}
+		byHash[hash] = txResult
+	}
+
+	matched := make([]*TransactionResult, len(block.Transactions))
+	var missing []string
+	for i, tx := range block.Transactions {
+		hash := NormalizeHash(tx.TransactionIdentifier.Hash)
+		txResult, ok := byHash[hash]
+		if !ok {
+			missing = append(missing, tx.TransactionIdentifier.Hash)
+			continue
+		}
+		delete(byHash, hash)
+		matched[i] = txResult
+	}
+	for _, txResult := range byHash {
+		extra = append(extra, txResult.Hash())
+	}
+
+	if len(missing) > 0 || len(extra) > 0 {
+		return nil, &ReceiptMismatchError{
+			Block:   block.BlockIdentifier,
+			Missing: missing,
+			Extra:   extra,
+		}
+	}
+	return matched, nil
+}
+
+// NormalizeHash returns hash in the form used to compare block and
+// transaction hashes, which ICON returns with or without the 0x prefix
+// depending on the block version.
+func NormalizeHash(hash string) string {
+	return strings.TrimPrefix(strings.ToLower(hash), "0x")
+}
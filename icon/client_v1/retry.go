@@ -0,0 +1,164 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/icon-project/goloop/server/jsonrpc"
+)
+
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryBackoff  = 200 * time.Millisecond
+	DefaultRetryMaxDelay = 5 * time.Second
+)
+
+// RetryPolicy controls how JsonRpcClient retries failed requests.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the second attempt. The delay is
+	// doubled for every following attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Jitter is the fraction of the delay that is randomized, in [0, 1].
+	Jitter float64
+
+	// NonIdempotent lists methods which must not be sent twice. They are
+	// only retried when the node was never reached.
+	NonIdempotent map[string]bool
+}
+
+// NewRetryPolicy returns a policy with the given attempts and initial
+// backoff, and the default settings for everything else.
+func NewRetryPolicy(attempts int, backoff time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: backoff,
+		MaxBackoff:     DefaultRetryMaxDelay,
+		Jitter:         0.5,
+		NonIdempotent: map[string]bool{
+			"icx_sendTransaction": true,
+		},
+	}
+}
+
+// DefaultRetryPolicy returns the policy used by NewJsonRpcClient.
+func DefaultRetryPolicy() *RetryPolicy {
+	return NewRetryPolicy(DefaultRetryAttempts, DefaultRetryBackoff)
+}
+
+// ShouldRetry reports whether a request for method which failed with err
+// on the given attempt (starting from 1) may be sent again.
+func (p *RetryPolicy) ShouldRetry(method string, attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.NonIdempotent[method] {
+		return IsUnreachable(err)
+	}
+	return IsRetriable(err)
+}
+
+// Backoff returns the delay to wait after the given attempt (starting from 1).
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 && d > 0 {
+		spread := time.Duration(float64(d) * p.Jitter)
+		d = d - spread + time.Duration(rand.Int63n(int64(spread)*2+1))
+	}
+	return d
+}
+
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	t := time.NewTimer(p.Backoff(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// IsRetriable reports whether err is a transient failure, so the same
+// request may succeed when it is sent again later.
+func IsRetriable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var jErr *jsonrpc.Error
+	if errors.As(err, &jErr) {
+		switch jErr.Code {
+		case jsonrpc.ErrorCodeServer,
+			jsonrpc.ErrorCodeSystem,
+			jsonrpc.ErrorCodeTxPoolOverflow,
+			jsonrpc.ErrorCodePending,
+			jsonrpc.ErrorCodeExecuting,
+			jsonrpc.ErrorLackOfResource,
+			jsonrpc.ErrorCodeTimeout,
+			jsonrpc.ErrorCodeSystemTimeout:
+			return true
+		}
+		return false
+	}
+
+	var hErr *HttpError
+	if errors.As(err, &hErr) {
+		return hErr.StatusCode == http.StatusTooManyRequests ||
+			hErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var nErr net.Error
+	if errors.As(err, &nErr) {
+		return nErr.Timeout() || IsUnreachable(err)
+	}
+	return false
+}
+
+// IsUnreachable reports whether err happened while connecting, before
+// any part of the request could reach the node.
+func IsUnreachable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial"
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/common"
+)
+
+// Sub-accounts of /account/balance. Delegated and bonded ICX are parts of
+// the staked ICX, the others do not overlap.
+const (
+	LiquidSubAccount    = "liquid"
+	StakeSubAccount     = "stake"
+	UnstakeSubAccount   = "unstake"
+	DelegatedSubAccount = "delegated"
+	BondedSubAccount    = "bonded"
+)
+
+// ErrUnknownSubAccount is returned for a sub-account which is not one of
+// the sub-accounts above.
+var ErrUnknownSubAccount = errors.New("unknown sub-account")
+
+// Unstake is ICX which is being unstaked, and becomes liquid again at
+// the unlock height.
+type Unstake struct {
+	Unstake            *common.HexInt  `json:"unstake"`
+	UnstakeBlockHeight common.HexInt64 `json:"unstakeBlockHeight"`
+}
+
+// Stake is the result of getStake. IISS 1 nodes return a single unstake
+// in the top level fields, later ones a list of unstakes.
+type Stake struct {
+	Stake              *common.HexInt   `json:"stake"`
+	Unstake            *common.HexInt   `json:"unstake"`
+	UnstakeBlockHeight *common.HexInt64 `json:"unstakeBlockHeight"`
+	Unstakes           []*Unstake       `json:"unstakes"`
+}
+
+// AllUnstakes returns the unstakes in the format of any IISS version.
+func (s *Stake) AllUnstakes() []*Unstake {
+	if s.Unstakes != nil || s.Unstake == nil || s.Unstake.Sign() == 0 {
+		return s.Unstakes
+	}
+	unstake := &Unstake{Unstake: s.Unstake}
+	if s.UnstakeBlockHeight != nil {
+		unstake.UnstakeBlockHeight = *s.UnstakeBlockHeight
+	}
+	return []*Unstake{unstake}
+}
+
+// GetSubAccount returns the balance of a staking sub-account of address,
+// at height when it is not empty.
+func (c *ClientV3) GetSubAccount(ctx context.Context, address string, subAccount string, height string) (*types.Amount, error) {
+	amount := &types.Amount{Currency: ICXCurrency}
+
+	switch subAccount {
+	case LiquidSubAccount:
+		var balance common.HexInt
+		param := &BalanceRPCRequest{Address: address, Height: height}
+		if _, err := c.Do(ctx, "icx_getBalance", param, &balance); err != nil {
+			return nil, err
+		}
+		amount.Value = balance.Text(10)
+
+	case StakeSubAccount, UnstakeSubAccount:
+		var stake Stake
+		if err := c.callSystem(ctx, "getStake", address, height, &stake); err != nil {
+			return nil, err
+		}
+		if subAccount == StakeSubAccount {
+			amount.Value = hexText(stake.Stake)
+			break
+		}
+		total := new(big.Int)
+		unstakes := []map[string]interface{}{}
+		for _, u := range stake.AllUnstakes() {
+			if u.Unstake == nil {
+				continue
+			}
+			total.Add(total, &u.Unstake.Int)
+			unstakes = append(unstakes, map[string]interface{}{
+				"value":         u.Unstake.Text(10),
+				"unlock_height": u.UnstakeBlockHeight.Value,
+			})
+		}
+		amount.Value = total.Text(10)
+		amount.Metadata = map[string]interface{}{
+			"unstakes": unstakes,
+		}
+
+	case DelegatedSubAccount:
+		var delegation struct {
+			TotalDelegated *common.HexInt `json:"totalDelegated"`
+		}
+		if err := c.callSystem(ctx, "getDelegation", address, height, &delegation); err != nil {
+			return nil, err
+		}
+		amount.Value = hexText(delegation.TotalDelegated)
+
+	case BondedSubAccount:
+		var bond struct {
+			TotalBonded *common.HexInt `json:"totalBonded"`
+		}
+		if err := c.callSystem(ctx, "getBond", address, height, &bond); err != nil {
+			return nil, err
+		}
+		amount.Value = hexText(bond.TotalBonded)
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSubAccount, subAccount)
+	}
+	return amount, nil
+}
+
+// GetSubAccountBalance returns the balance of a staking sub-account of
+// address at the latest block, along with that block.
+func (c *ClientV3) GetSubAccountBalance(ctx context.Context, address string, subAccount string) (*types.AccountBalanceResponse, error) {
+	var amount *types.Amount
+	header, err := c.atLatestBlock(ctx, func(height string) error {
+		var err error
+		amount, err = c.GetSubAccount(ctx, address, subAccount, height)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &types.AccountBalanceResponse{
+		BlockIdentifier: header.Identifier(),
+		Balances:        []*types.Amount{amount},
+	}, nil
+}
+
+// callSystem calls a read-only method of the system SCORE with the
+// address parameter, at height when it is not empty.
+func (c *ClientV3) callSystem(ctx context.Context, method string, address string, height string, resp interface{}) error {
+	params := map[string]interface{}{
+		"address": address,
+	}
+	return c.callScore(ctx, SystemScoreAddress, method, params, height, resp)
+}
+
+func hexText(v *common.HexInt) string {
+	if v == nil {
+		return "0"
+	}
+	return v.Text(10)
+}
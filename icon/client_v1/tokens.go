@@ -0,0 +1,249 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/common"
+)
+
+// ContractAddressKey is the key of the token contract address in the
+// metadata of a token currency.
+const ContractAddressKey = "contract_address"
+
+// ErrUnsupportedCurrency is returned for a currency which is neither ICX
+// nor an IRC2 token with its contract in metadata.
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// Token is an entry of a token registry file.
+type Token struct {
+	Address  string `json:"address"`
+	Name     string `json:"name,omitempty"`
+	Symbol   string `json:"symbol"`
+	Decimals int32  `json:"decimals"`
+}
+
+// Currency returns the Rosetta currency of the token.
+func (t *Token) Currency() *types.Currency {
+	currency := &types.Currency{
+		Symbol:   t.Symbol,
+		Decimals: t.Decimals,
+		Metadata: map[string]interface{}{
+			ContractAddressKey: t.Address,
+		},
+	}
+	if len(t.Name) > 0 {
+		currency.Metadata["name"] = t.Name
+	}
+	return currency
+}
+
+// TokenRegistry maps IRC2 token contracts to their currencies. Contracts
+// which are not in the registry are skipped, unless they are resolved on
+// demand by calling their name, symbol and decimals methods.
+type TokenRegistry struct {
+	resolve bool
+
+	mtx    sync.RWMutex
+	tokens map[string]*types.Currency
+}
+
+// NewTokenRegistry creates an empty registry, resolving unknown contracts
+// on demand when resolve is set.
+func NewTokenRegistry(resolve bool) *TokenRegistry {
+	return &TokenRegistry{
+		resolve: resolve,
+		tokens:  map[string]*types.Currency{},
+	}
+}
+
+// LoadTokenRegistry creates a registry holding the tokens listed in the
+// JSON file at path.
+func LoadTokenRegistry(path string, resolve bool) (*TokenRegistry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to read token registry %s", err, path)
+	}
+	var tokens []*Token
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse token registry %s", err, path)
+	}
+
+	r := NewTokenRegistry(resolve)
+	for _, t := range tokens {
+		if !strings.HasPrefix(t.Address, "cx") || len(t.Symbol) == 0 {
+			return nil, fmt.Errorf("invalid token %s %s in %s", t.Address, t.Symbol, path)
+		}
+		r.Add(t)
+	}
+	return r, nil
+}
+
+// Add registers t.
+func (r *TokenRegistry) Add(t *Token) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.tokens[t.Address] = t.Currency()
+}
+
+// Currency returns the currency of the token at address. ok is false for
+// contracts which are not known to be tokens.
+func (r *TokenRegistry) Currency(address string) (currency *types.Currency, ok bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	currency = r.tokens[address]
+	return currency, currency != nil
+}
+
+// Tokens returns the currencies of all known tokens.
+func (r *TokenRegistry) Tokens() []*types.Currency {
+	if r == nil {
+		return nil
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	currencies := make([]*types.Currency, 0, len(r.tokens))
+	for _, currency := range r.tokens {
+		if currency != nil {
+			currencies = append(currencies, currency)
+		}
+	}
+	return currencies
+}
+
+// ResolveTokens adds the contracts emitting IRC2 transfers in trs which
+// are not in the registry yet, if the registry resolves contracts on
+// demand. Contracts which fail to answer are remembered as not being
+// tokens.
+func (c *ClientV3) ResolveTokens(ctx context.Context, trs []*TransactionResult) error {
+	r := c.Tokens
+	if r == nil || !r.resolve {
+		return nil
+	}
+
+	for _, tr := range trs {
+		if tr == nil {
+			continue
+		}
+		for _, el := range tr.EventLogs {
+			if el == nil || len(el.Indexed) == 0 || el.Indexed[0] == nil || *el.Indexed[0] != irc2TransferSig {
+				continue
+			}
+			r.mtx.RLock()
+			_, known := r.tokens[el.Addr]
+			r.mtx.RUnlock()
+			if known {
+				continue
+			}
+
+			token, err := c.GetToken(ctx, el.Addr)
+			if err != nil && !errors.Is(err, ErrScore) {
+				return err
+			}
+			r.mtx.Lock()
+			if token != nil {
+				r.tokens[el.Addr] = token.Currency()
+			} else {
+				r.tokens[el.Addr] = nil
+			}
+			r.mtx.Unlock()
+		}
+	}
+	return nil
+}
+
+// GetToken reads the name, the symbol and the decimals of the IRC2 token
+// at address.
+func (c *ClientV3) GetToken(ctx context.Context, address string) (*Token, error) {
+	token := &Token{Address: address}
+	if err := c.callScore(ctx, address, "name", nil, "", &token.Name); err != nil {
+		return nil, err
+	}
+	if err := c.callScore(ctx, address, "symbol", nil, "", &token.Symbol); err != nil {
+		return nil, err
+	}
+	var decimals common.HexInt64
+	if err := c.callScore(ctx, address, "decimals", nil, "", &decimals); err != nil {
+		return nil, err
+	}
+	token.Decimals = int32(decimals.Value)
+	return token, nil
+}
+
+// GetTokenBalance returns the balance of owner in the IRC2 token at
+// contract, at height when it is not empty.
+func (c *ClientV3) GetTokenBalance(ctx context.Context, contract string, owner string, height string) (string, error) {
+	var balance common.HexInt
+	params := map[string]interface{}{"_owner": owner}
+	if err := c.callScore(ctx, contract, "balanceOf", params, height, &balance); err != nil {
+		return "", err
+	}
+	return balance.Text(10), nil
+}
+
+// TokenContract returns the contract of an IRC2 token currency, which is
+// kept in its metadata, or an empty string for ICX.
+func TokenContract(currency *types.Currency) (string, error) {
+	if v, ok := currency.Metadata[ContractAddressKey]; ok {
+		contract, ok := v.(string)
+		if !ok || !strings.HasPrefix(contract, "cx") {
+			return "", fmt.Errorf("%w: invalid %s %v", ErrUnsupportedCurrency, ContractAddressKey, v)
+		}
+		return contract, nil
+	}
+	if currency.Symbol == ICXSymbol && currency.Decimals == ICXDecimals {
+		return "", nil
+	}
+	return "", fmt.Errorf("%w: %s has no %s", ErrUnsupportedCurrency, currency.Symbol, ContractAddressKey)
+}
+
+// callScore calls a read-only method of the SCORE at address, at height
+// when it is not empty.
+func (c *ClientV3) callScore(
+	ctx context.Context,
+	address string,
+	method string,
+	params map[string]interface{},
+	height string,
+	resp interface{},
+) error {
+	data := map[string]interface{}{
+		"method": method,
+	}
+	if params != nil {
+		data["params"] = params
+	}
+	req := map[string]interface{}{
+		"to":       address,
+		"dataType": "call",
+		"data":     data,
+	}
+	if height != "" {
+		req["height"] = height
+	}
+	_, err := c.Do(ctx, "icx_call", req, resp)
+	return err
+}
@@ -9,9 +9,8 @@ func ParseGenesisTransaction(txArray []json.RawMessage) ([]*types.Transaction, e
 	var transactions []*types.Transaction
 
 	for _, raw := range txArray {
-		bs, _ := raw.MarshalJSON()
 		genesisTransaction := GenesisTransaction{}
-		if err := json.Unmarshal(bs, &genesisTransaction); err != nil {
+		if err := json.Unmarshal(raw, &genesisTransaction); err != nil {
 			return nil, err
 		}
 
@@ -30,7 +29,10 @@ func ParseGenesisTransaction(txArray []json.RawMessage) ([]*types.Transaction, e
 }
 
 func ParseTransactionV2(transaction Transaction) (*types.Transaction, error) {
-	operations, _ := ParseOperationsV2(transaction)
+	operations, err := ParseOperationsV2(transaction)
+	if err != nil {
+		return nil, err
+	}
 	return &types.Transaction{
 		TransactionIdentifier: &types.TransactionIdentifier{
 			Hash: transaction.TxHashV2.String(),
@@ -41,7 +43,10 @@ func ParseTransactionV2(transaction Transaction) (*types.Transaction, error) {
 }
 
 func ParseTransactionV3(transaction Transaction) (*types.Transaction, error) {
-	operations, _ := ParseOperationsV3(transaction)
+	operations, err := ParseOperationsV3(transaction)
+	if err != nil {
+		return nil, err
+	}
 
 	return &types.Transaction{
 		TransactionIdentifier: &types.TransactionIdentifier{
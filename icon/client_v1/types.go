@@ -22,6 +22,7 @@ import (
 	"github.com/icon-project/goloop/common/crypto"
 	"github.com/icon-project/goloop/service/transaction"
 	"math/big"
+	"strings"
 )
 
 var (
@@ -40,6 +41,10 @@ var (
 		ICXTransferOpType,
 		ClaimOpType,
 		MessageOpType,
+		IRC2TransferOpType,
+		IRC3TransferOpType,
+		IRC31TransferSingleOpType,
+		IRC31TransferBatchOpType,
 	}
 
 	// OperationStatuses are all supported operation statuses.
@@ -82,21 +87,27 @@ const (
 	ICXDecimals = 18
 
 	GenesisBlockIndex          = int64(0)
-	HistoricalBalanceSupported = false
-
-	TreasuryAddress    = "hx1000000000000000000000000000000000000000"
-	SystemScoreAddress = "cx0000000000000000000000000000000000000000"
-
-	GenesisOpType     = "GENESIS"
-	TransferOpType    = "TRANSFER"
-	FeeOpType         = "FEE"
-	BaseOpType        = "BASE"
-	BurnOpType        = "BURN"
-	WithdrawnType     = "WITHDRAWN"
-	ICXTransferOpType = "ICXTRANSFER"
-	ClaimOpType       = "CLAIM"
-	IssueOpType       = "ISSUE"
-	MessageOpType     = "MESSAGE"
+	HistoricalBalanceSupported = true
+
+	TreasuryAddress        = "hx1000000000000000000000000000000000000000"
+	SystemScoreAddress     = "cx0000000000000000000000000000000000000000"
+	GovernanceScoreAddress = "cx0000000000000000000000000000000000000001"
+
+	GenesisOpType      = "GENESIS"
+	TransferOpType     = "TRANSFER"
+	FeeOpType          = "FEE"
+	BaseOpType         = "BASE"
+	BurnOpType         = "BURN"
+	WithdrawnType      = "WITHDRAWN"
+	ICXTransferOpType  = "ICXTRANSFER"
+	ClaimOpType        = "CLAIM"
+	IssueOpType        = "ISSUE"
+	MessageOpType      = "MESSAGE"
+	IRC2TransferOpType = "IRC2TRANSFER"
+
+	IRC3TransferOpType        = "IRC3TRANSFER"
+	IRC31TransferSingleOpType = "IRC31TRANSFERSINGLE"
+	IRC31TransferBatchOpType  = "IRC31TRANSFERBATCH"
 
 	BaseDataType = "base"
 
@@ -115,7 +126,8 @@ type TransactionRPCRequest struct {
 
 type BalanceRPCRequest struct {
 	Address string `json:"address"`
-	Filter  string `json:"filter"`
+	Filter  string `json:"filter,omitempty"`
+	Height  string `json:"height,omitempty"`
 }
 
 type Block01a struct {
@@ -230,6 +242,81 @@ func (b *Block03) Meta() map[string]interface{} {
 	}
 }
 
+// Block20 is the block format of goloop nodes, which follows the 0.1a
+// format except that the height and the timestamp are plain numbers.
+// Fields which later versions add, such as BTP data, are kept in Extra.
+type Block20 struct {
+	ID                 common.HexBytes            `json:"block_hash"`
+	Version            string                     `json:"version"`
+	Height             common.HexInt64            `json:"height"`
+	Timestamp          common.HexInt64            `json:"time_stamp"`
+	Proposer           string                     `json:"peer_id"`
+	PrevID             common.HexBytes            `json:"prev_block_hash"`
+	MerkleTreeRootHash common.HexBytes            `json:"merkle_tree_root_hash"`
+	Signature          string                     `json:"signature"`
+	Transactions       []json.RawMessage          `json:"confirmed_transaction_list"`
+	Extra              map[string]json.RawMessage `json:"-"`
+}
+
+var block20Fields = []string{
+	"block_hash",
+	"version",
+	"height",
+	"time_stamp",
+	"peer_id",
+	"prev_block_hash",
+	"merkle_tree_root_hash",
+	"signature",
+	"confirmed_transaction_list",
+}
+
+func (b *Block20) UnmarshalJSON(data []byte) error {
+	type block20 Block20
+	if err := json.Unmarshal(data, (*block20)(b)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, key := range block20Fields {
+		delete(fields, key)
+	}
+	if len(fields) > 0 {
+		b.Extra = fields
+	}
+	return nil
+}
+
+func (b *Block20) Number() int64 {
+	return b.Height.Value
+}
+
+func (b *Block20) Hash() string {
+	return b.ID.String()
+}
+
+func (b *Block20) PrevHash() string {
+	return b.PrevID.String()
+}
+
+func (b *Block20) TimestampMilli() int64 {
+	return b.Timestamp.Value / 1000
+}
+
+func (b *Block20) Meta() map[string]interface{} {
+	meta := map[string]interface{}{
+		"version":               b.Version,
+		"peer_id":               b.Proposer,
+		"signature":             b.Signature,
+		"merkle_tree_root_hash": b.MerkleTreeRootHash,
+	}
+	for key, value := range b.Extra {
+		meta[key] = value
+	}
+	return meta
+}
+
 type GenesisAccount struct {
 	Name    string         `json:"name"`
 	Address common.Address `json:"address"`
@@ -313,6 +400,7 @@ func (tx *Transaction) MetaV3() map[string]interface{} {
 		meta["nid"] = &tx.NID
 		meta["nonce"] = &tx.Nonce
 		meta["signature"] = &tx.Signature
+		meta["stepLimit"] = tx.StepLimit.Text(10)
 		return meta
 	}
 }
@@ -480,17 +568,109 @@ type TransactionResult struct {
 	StepDetails        map[string]*common.HexInt `json:"stepUsedDetails"`
 }
 
-type BalanceWithBlockId struct {
-	ID     common.HexBytes `json:"block_hash"`
-	Height common.HexInt64 `json:"height"`
+// ToAddr returns the receiver of the transaction.
+func (tr *TransactionResult) ToAddr() string {
+	var to string
+	if tr.To != nil {
+		_ = json.Unmarshal(*tr.To, &to)
+	}
+	return to
 }
 
-func (info *BalanceWithBlockId) Hash() string {
-	return info.ID.String()
+// Failure is the reason of a failed transaction.
+type Failure struct {
+	Code    common.HexInt64 `json:"code"`
+	Message string          `json:"message"`
+}
+
+// FailureReason returns why the transaction failed, or nil when it did
+// not. The reason is kept as sent by the node when it can not be read.
+func (tr *TransactionResult) FailureReason() interface{} {
+	if tr.Failure == nil || string(*tr.Failure) == "null" {
+		return nil
+	}
+	failure := &Failure{}
+	if err := json.Unmarshal(*tr.Failure, failure); err != nil {
+		return tr.Failure
+	}
+	return failure
+}
+
+// ScoreAddr returns the SCORE the transaction deployed, or else the one
+// it called, if any.
+func (tr *TransactionResult) ScoreAddr() string {
+	var score string
+	if tr.ScoreAddress != nil {
+		_ = json.Unmarshal(*tr.ScoreAddress, &score)
+	}
+	if score == "" && strings.HasPrefix(tr.ToAddr(), "cx") {
+		score = tr.ToAddr()
+	}
+	return score
+}
+
+// Hash returns the hash of the transaction.
+func (tr *TransactionResult) Hash() string {
+	var hash string
+	if tr.TxHash != nil {
+		_ = json.Unmarshal(*tr.TxHash, &hash)
+	}
+	return hash
+}
+
+// Block returns the block which includes the transaction, or nil if the
+// node did not tell.
+func (tr *TransactionResult) Block() *types.BlockIdentifier {
+	if tr.BlockHeight == nil || tr.BlockHash == nil {
+		return nil
+	}
+	var height common.HexInt64
+	var hash string
+	if json.Unmarshal(*tr.BlockHeight, &height) != nil || json.Unmarshal(*tr.BlockHash, &hash) != nil {
+		return nil
+	}
+	return &types.BlockIdentifier{
+		Index: height.Value,
+		Hash:  hash,
+	}
+}
+
+// BlockHeader is the part of the legacy icx_getLastBlock result which
+// identifies the latest block.
+type BlockHeader struct {
+	ID        common.HexBytes `json:"block_hash"`
+	Height    common.HexInt64 `json:"height"`
+	Timestamp common.HexInt64 `json:"time_stamp"`
+}
+
+// anyBlockHeader reads the header fields of an icx_getBlock result of any
+// block version, which name them differently.
+type anyBlockHeader struct {
+	LegacyID        common.HexBytes `json:"block_hash"`
+	ID              common.HexBytes `json:"hash"`
+	Height          common.HexInt64 `json:"height"`
+	LegacyTimestamp common.HexInt64 `json:"time_stamp"`
+	Timestamp       common.HexInt64 `json:"timestamp"`
+}
+
+func (h *anyBlockHeader) header() *BlockHeader {
+	header := &BlockHeader{ID: h.ID, Height: h.Height, Timestamp: h.Timestamp}
+	if len(header.ID) == 0 {
+		header.ID = h.LegacyID
+		header.Timestamp = h.LegacyTimestamp
+	}
+	return header
+}
+
+func (h *BlockHeader) Identifier() *types.BlockIdentifier {
+	return &types.BlockIdentifier{
+		Index: h.Height.Value,
+		Hash:  h.ID.String(),
+	}
 }
 
-func (info *BalanceWithBlockId) Number() int64 {
-	return info.Height.Value
+func (h *BlockHeader) TimestampMilli() int64 {
+	return h.Timestamp.Value / 1000
 }
 
 type coin struct {
@@ -0,0 +1,638 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emulator
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icon-project/goloop/common"
+	"github.com/icon-project/goloop/common/crypto"
+	"github.com/icon-project/goloop/server/jsonrpc"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+)
+
+const (
+	blockVersion    = "0.5"
+	goloopVersion   = "2.0"
+	genesisVersion  = "0.1a"
+	genesisMessage  = "A rhizome has no beginning or end; it is always in the middle, between things, interbeing, intermezzo."
+	statusSuccess   = "0x1"
+	statusFailure   = "0x0"
+	failureNotFound = "0x7d64"
+	failureScore    = "0x7d00"
+	genesisTxHash   = "0x0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+var (
+	// IssuePerBlock is the amount of ICX issued to the treasury in the
+	// base transaction of every block.
+	IssuePerBlock = big.NewInt(1000000000000000000)
+
+	// TransferStep is the number of steps used by a plain ICX transfer.
+	TransferStep = client_v1.TransferStepCost
+
+	// DataStepPerByte is the number of steps used per byte of
+	// transaction data.
+	DataStepPerByte = big.NewInt(25)
+)
+
+// Account is the state of a single address. Delegated and Bonded are
+// parts of Stake. Unstake becomes liquid again at UnlockHeight.
+type Account struct {
+	Balance      *big.Int
+	Stake        *big.Int
+	Unstake      *big.Int
+	UnlockHeight int64
+	Delegated    *big.Int
+	Bonded       *big.Int
+}
+
+func newAccount() *Account {
+	return &Account{
+		Balance:   new(big.Int),
+		Stake:     new(big.Int),
+		Unstake:   new(big.Int),
+		Delegated: new(big.Int),
+		Bonded:    new(big.Int),
+	}
+}
+
+type transaction struct {
+	raw    map[string]interface{}
+	tx     *client_v1.Transaction
+	hash   string
+	height int64
+	index  int
+}
+
+type block struct {
+	height    int64
+	hash      string
+	prevHash  string
+	timestamp int64
+	txs       []*transaction
+	receipts  []map[string]interface{}
+	state     map[string]*Account
+}
+
+// Chain is the state of an emulated ICON node: accounts, blocks and the
+// transactions waiting to be included in the next block.
+type Chain struct {
+	mtx sync.Mutex
+
+	nid      int64
+	preps    []string
+	accounts map[string]*Account
+	genesis  []map[string]interface{}
+	blocks   []*block
+	byHash   map[string]*block
+	txs      map[string]*transaction
+	pending  []*transaction
+	tokens   map[string]*Token
+}
+
+// Token is an IRC2 token contract. Its transfer method moves tokens and
+// emits a Transfer event.
+type Token struct {
+	Name     string
+	Symbol   string
+	Decimals int32
+	Balances map[string]*big.Int
+}
+
+// NewChain creates a chain whose genesis block gives balances to the
+// given accounts. preps are reported as main P-Reps.
+func NewChain(nid int64, balances map[string]*big.Int, preps []string) *Chain {
+	c := &Chain{
+		nid:      nid,
+		preps:    preps,
+		accounts: map[string]*Account{},
+		byHash:   map[string]*block{},
+		txs:      map[string]*transaction{},
+		tokens:   map[string]*Token{},
+	}
+	for addr, balance := range balances {
+		c.account(addr).Balance.Set(balance)
+		c.genesis = append(c.genesis, map[string]interface{}{
+			"name":    addr,
+			"address": addr,
+			"balance": hexInt(balance),
+		})
+	}
+
+	genesis := &block{
+		height:    0,
+		timestamp: time.Now().UnixNano() / int64(time.Microsecond),
+	}
+	genesis.hash = blockHash(genesis)
+	genesis.receipts = []map[string]interface{}{
+		{
+			"txHash":             genesisTxHash,
+			"txIndex":            "0x0",
+			"blockHeight":        "0x0",
+			"blockHash":          genesis.hash,
+			"to":                 client_v1.TreasuryAddress,
+			"stepUsed":           "0x0",
+			"stepPrice":          "0x0",
+			"cumulativeStepUsed": "0x0",
+			"logsBloom":          "0x" + strings.Repeat("00", 256),
+			"eventLogs":          []interface{}{},
+			"status":             statusSuccess,
+		},
+	}
+	c.addBlock(genesis)
+	return c
+}
+
+func (c *Chain) account(addr string) *Account {
+	a, ok := c.accounts[addr]
+	if !ok {
+		a = newAccount()
+		c.accounts[addr] = a
+	}
+	return a
+}
+
+func (c *Chain) addBlock(b *block) {
+	b.state = make(map[string]*Account, len(c.accounts))
+	for addr, a := range c.accounts {
+		b.state[addr] = a.copy()
+	}
+	c.blocks = append(c.blocks, b)
+	c.byHash[b.hash] = b
+	for _, tx := range b.txs {
+		c.txs[tx.hash] = tx
+	}
+}
+
+func (a *Account) copy() *Account {
+	c := newAccount()
+	c.Balance.Set(a.Balance)
+	c.Stake.Set(a.Stake)
+	c.Unstake.Set(a.Unstake)
+	c.UnlockHeight = a.UnlockHeight
+	if a.Delegated != nil {
+		c.Delegated.Set(a.Delegated)
+	}
+	if a.Bonded != nil {
+		c.Bonded.Set(a.Bonded)
+	}
+	return c
+}
+
+// Account returns a copy of the state of addr.
+func (c *Chain) Account(addr string) *Account {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.account(addr).copy()
+}
+
+// AccountAt returns a copy of the state of addr after the block at
+// height. ok is false if there is no such block.
+func (c *Chain) AccountAt(addr string, height int64) (a *Account, ok bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if height < 0 || height >= int64(len(c.blocks)) {
+		return nil, false
+	}
+	if a, ok := c.blocks[height].state[addr]; ok {
+		return a.copy(), true
+	}
+	return newAccount(), true
+}
+
+// DeployToken deploys the IRC2 token t at the contract address.
+func (c *Chain) DeployToken(address string, t *Token) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if t.Balances == nil {
+		t.Balances = map[string]*big.Int{}
+	}
+	c.tokens[address] = t
+}
+
+// TokenBalance returns the balance of addr in the token at address.
+func (c *Chain) TokenBalance(address string, addr string) (*big.Int, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	t, ok := c.tokens[address]
+	if !ok {
+		return nil, false
+	}
+	return t.balance(addr), true
+}
+
+func (t *Token) balance(addr string) *big.Int {
+	if b, ok := t.Balances[addr]; ok {
+		return new(big.Int).Set(b)
+	}
+	return new(big.Int)
+}
+
+// SetAccount replaces the state of addr. The state of past blocks is left
+// unchanged.
+func (c *Chain) SetAccount(addr string, a *Account) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.accounts[addr] = a.copy()
+}
+
+// Height returns the height of the last block.
+func (c *Chain) Height() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.last().height
+}
+
+func (c *Chain) last() *block {
+	return c.blocks[len(c.blocks)-1]
+}
+
+// Submit verifies a signed transaction and queues it for the next block.
+// It returns the transaction hash.
+func (c *Chain) Submit(params json.RawMessage) (string, error) {
+	tx, err := client_v1.ParseV3JSON(params)
+	if err != nil {
+		return "", jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+	}
+	if tx.Signature == nil {
+		return "", jsonrpc.ErrorCodeInvalidParams.New("no signature")
+	}
+	if err := tx.VerifySignature(); err != nil {
+		return "", jsonrpc.ErrorCodeInvalidRequest.New(err.Error())
+	}
+	if tx.NID == nil || tx.NID.Value != c.nid {
+		return "", jsonrpc.ErrorCodeInvalidRequest.New("invalid nid")
+	}
+
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(params, &raw); err != nil {
+		return "", jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+	}
+	hash := "0x" + hex.EncodeToString(tx.TxHash())
+	raw["txHash"] = hash
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.txs[hash]; ok {
+		return "", jsonrpc.ErrorCodeInvalidRequest.New("transaction already exists")
+	}
+	for _, p := range c.pending {
+		if p.hash == hash {
+			return "", jsonrpc.ErrorCodeInvalidRequest.New("transaction already exists")
+		}
+	}
+
+	required := new(big.Int).Mul(&tx.StepLimit.Int, client_v1.StepPrice)
+	if tx.Value != nil {
+		required.Add(required, &tx.Value.Int)
+	}
+	if c.account(tx.From.String()).Balance.Cmp(required) < 0 {
+		return "", jsonrpc.ErrorCodeInvalidRequest.New("out of balance")
+	}
+
+	c.pending = append(c.pending, &transaction{raw: raw, tx: tx, hash: hash})
+	return hash, nil
+}
+
+// Produce builds a new block from the base transaction and every pending
+// transaction, and applies them to the accounts.
+func (c *Chain) Produce() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	prev := c.last()
+	b := &block{
+		height:    prev.height + 1,
+		prevHash:  prev.hash,
+		timestamp: time.Now().UnixNano() / int64(time.Microsecond),
+	}
+
+	base := c.baseTransaction(b)
+	b.txs = append([]*transaction{base}, c.pending...)
+	c.pending = nil
+	for i, tx := range b.txs {
+		tx.height = b.height
+		tx.index = i
+	}
+	b.hash = blockHash(b)
+
+	cumulative := new(big.Int)
+	for _, tx := range b.txs {
+		receipt := c.execute(tx, cumulative)
+		receipt["blockHeight"] = hexInt64(b.height)
+		receipt["blockHash"] = b.hash
+		b.receipts = append(b.receipts, receipt)
+	}
+	c.addBlock(b)
+	return b.height
+}
+
+func (c *Chain) baseTransaction(b *block) *transaction {
+	data := map[string]interface{}{
+		"prep": map[string]interface{}{
+			"irep":  "0x0",
+			"rrep":  "0x0",
+			"value": hexInt(IssuePerBlock),
+		},
+		"result": map[string]interface{}{
+			"coveredByFee":           "0x0",
+			"coveredByOverIssuedICX": "0x0",
+			"issue":                  hexInt(IssuePerBlock),
+		},
+	}
+	raw := map[string]interface{}{
+		"version":   "0x3",
+		"timestamp": hexInt64(b.timestamp),
+		"dataType":  client_v1.BaseDataType,
+		"data":      data,
+	}
+	bs, _ := json.Marshal(raw)
+	hash := "0x" + hex.EncodeToString(crypto.SHA3Sum256(append(bs, []byte(b.prevHash)...)))
+	raw["txHash"] = hash
+	return &transaction{raw: raw, hash: hash}
+}
+
+// execute applies tx to the accounts and returns its receipt.
+func (c *Chain) execute(tx *transaction, cumulative *big.Int) map[string]interface{} {
+	receipt := map[string]interface{}{
+		"txHash":    tx.hash,
+		"txIndex":   hexInt64(int64(tx.index)),
+		"stepPrice": hexInt(client_v1.StepPrice),
+		"logsBloom": "0x" + strings.Repeat("00", 256),
+		"eventLogs": []interface{}{},
+	}
+
+	if tx.tx == nil {
+		// The base transaction issues ICX to the treasury.
+		treasury := c.account(client_v1.TreasuryAddress)
+		treasury.Balance.Add(treasury.Balance, IssuePerBlock)
+		receipt["to"] = client_v1.SystemScoreAddress
+		receipt["status"] = statusSuccess
+		receipt["stepUsed"] = "0x0"
+		receipt["cumulativeStepUsed"] = hexInt(cumulative)
+		receipt["eventLogs"] = []interface{}{
+			map[string]interface{}{
+				"scoreAddress": client_v1.SystemScoreAddress,
+				"indexed":      []interface{}{"ICXIssued(int,int,int,int)"},
+				"data":         []interface{}{"0x0", "0x0", hexInt(IssuePerBlock), "0x0"},
+			},
+		}
+		return receipt
+	}
+
+	from := tx.tx.FromAddr()
+	to := tx.tx.ToAddr()
+	receipt["to"] = to
+
+	step := EstimateStep(tx.tx)
+	if step.Cmp(&tx.tx.StepLimit.Int) > 0 {
+		step.Set(&tx.tx.StepLimit.Int)
+	}
+	fee := new(big.Int).Mul(step, client_v1.StepPrice)
+	cumulative.Add(cumulative, step)
+
+	fa := c.account(from)
+	fa.Balance.Sub(fa.Balance, fee)
+	treasury := c.account(client_v1.TreasuryAddress)
+	treasury.Balance.Add(treasury.Balance, fee)
+
+	receipt["stepUsed"] = hexInt(step)
+	receipt["cumulativeStepUsed"] = hexInt(cumulative)
+	receipt["stepUsedDetails"] = map[string]interface{}{
+		from: hexInt(step),
+	}
+
+	if t, ok := c.tokens[to]; ok {
+		if log, err := t.transfer(from, tx.tx); err != nil {
+			receipt["status"] = statusFailure
+			receipt["failure"] = map[string]interface{}{
+				"code":    failureScore,
+				"message": err.Error(),
+			}
+		} else {
+			receipt["status"] = statusSuccess
+			log["scoreAddress"] = to
+			receipt["eventLogs"] = []interface{}{log}
+		}
+		return receipt
+	}
+
+	// Only the system SCORE and the tokens exist on the emulated chain,
+	// so calls to any other contract fail.
+	if tx.tx.To.IsContract() && to != client_v1.SystemScoreAddress {
+		receipt["status"] = statusFailure
+		receipt["failure"] = map[string]interface{}{
+			"code":    failureNotFound,
+			"message": fmt.Sprintf("ContractNotFound(%s)", to),
+		}
+		return receipt
+	}
+
+	if tx.tx.Value != nil {
+		fa.Balance.Sub(fa.Balance, &tx.tx.Value.Int)
+		ta := c.account(to)
+		ta.Balance.Add(ta.Balance, &tx.tx.Value.Int)
+	}
+	receipt["status"] = statusSuccess
+	return receipt
+}
+
+// transfer executes a call of the transfer method of the token, and
+// returns its Transfer event.
+func (t *Token) transfer(from string, tx *client_v1.Transaction) (map[string]interface{}, error) {
+	var call struct {
+		Method string `json:"method"`
+		Params struct {
+			To    string        `json:"_to"`
+			Value common.HexInt `json:"_value"`
+		} `json:"params"`
+	}
+	if tx.DataType == nil || *tx.DataType != "call" || json.Unmarshal(tx.Data, &call) != nil {
+		return nil, errors.New("InvalidCall")
+	}
+	if call.Method != "transfer" {
+		return nil, fmt.Errorf("MethodNotFound(%s)", call.Method)
+	}
+	value := &call.Params.Value.Int
+	balance := t.balance(from)
+	if value.Sign() < 0 || balance.Cmp(value) < 0 {
+		return nil, errors.New("InsufficientBalance")
+	}
+	t.Balances[from] = balance.Sub(balance, value)
+	t.Balances[call.Params.To] = t.balance(call.Params.To).Add(t.balance(call.Params.To), value)
+	return map[string]interface{}{
+		"indexed": []interface{}{"Transfer(Address,Address,int,bytes)", from, call.Params.To, hexInt(value)},
+		"data":    []interface{}{"0x"},
+	}, nil
+}
+
+// EstimateStep returns the steps tx uses on the emulated chain.
+func EstimateStep(tx *client_v1.Transaction) *big.Int {
+	step := new(big.Int).Set(TransferStep)
+	if len(tx.Data) > 0 {
+		step.Add(step, new(big.Int).Mul(DataStepPerByte, big.NewInt(int64(len(tx.Data)))))
+	}
+	return step
+}
+
+func (c *Chain) blockByParams(params json.RawMessage) (*block, error) {
+	var req client_v1.BlockRPCRequest
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+		}
+	}
+	switch {
+	case req.Hash != "":
+		b, ok := c.byHash[req.Hash]
+		if !ok {
+			return nil, jsonrpc.ErrorCodeNotFound.New("block not found")
+		}
+		return b, nil
+	case req.Height != "":
+		var h common.HexInt64
+		if err := h.UnmarshalJSON([]byte(req.Height)); err != nil {
+			return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+		}
+		if h.Value < 0 || h.Value >= int64(len(c.blocks)) {
+			return nil, jsonrpc.ErrorCodeNotFound.New("block not found")
+		}
+		return c.blocks[h.Value], nil
+	default:
+		return c.last(), nil
+	}
+}
+
+func (c *Chain) blockJSON(b *block) map[string]interface{} {
+	if b.height == 0 {
+		return map[string]interface{}{
+			"version":               genesisVersion,
+			"height":                hexInt64(0),
+			"time_stamp":            hexInt64(b.timestamp),
+			"block_hash":            b.hash,
+			"prev_block_hash":       "",
+			"merkle_tree_root_hash": b.hash,
+			"peer_id":               "",
+			"signature":             "",
+			"next_leader":           "",
+			"confirmed_transaction_list": []interface{}{
+				map[string]interface{}{
+					"accounts": c.genesis,
+					"message":  genesisMessage,
+				},
+			},
+		}
+	}
+
+	txs := make([]interface{}, len(b.txs))
+	for i, tx := range b.txs {
+		txs[i] = tx.raw
+	}
+	return map[string]interface{}{
+		"version":          blockVersion,
+		"height":           hexInt64(b.height),
+		"timestamp":        hexInt64(b.timestamp),
+		"hash":             b.hash,
+		"prevHash":         b.prevHash,
+		"transactionsHash": b.hash,
+		"stateHash":        b.hash,
+		"receiptsHash":     b.hash,
+		"repsHash":         b.hash,
+		"nextRepsHash":     b.hash,
+		"leaderVotesHash":  b.hash,
+		"prevVotesHash":    b.hash,
+		"logsBloom":        "0x" + strings.Repeat("00", 256),
+		"leaderVotes":      []interface{}{},
+		"prevVotes":        []interface{}{},
+		"leader":           c.leader(),
+		"nextLeader":       c.leader(),
+		"transactions":     txs,
+	}
+}
+
+// goloopBlockJSON is the 2.0 format of goloop nodes, with hashes without
+// the 0x prefix and the height and the timestamp as plain numbers.
+func (c *Chain) goloopBlockJSON(b *block) map[string]interface{} {
+	txs := make([]interface{}, len(b.txs))
+	for i, tx := range b.txs {
+		txs[i] = tx.raw
+	}
+	return map[string]interface{}{
+		"version":                    goloopVersion,
+		"height":                     b.height,
+		"time_stamp":                 b.timestamp,
+		"block_hash":                 strings.TrimPrefix(b.hash, "0x"),
+		"prev_block_hash":            strings.TrimPrefix(b.prevHash, "0x"),
+		"merkle_tree_root_hash":      strings.TrimPrefix(b.hash, "0x"),
+		"peer_id":                    c.leader(),
+		"signature":                  "",
+		"confirmed_transaction_list": txs,
+	}
+}
+
+// lastBlockJSON is the legacy block format of icx_getLastBlock.
+func (c *Chain) lastBlockJSON() map[string]interface{} {
+	b := c.last()
+	return map[string]interface{}{
+		"version":    genesisVersion,
+		"height":     b.height,
+		"block_hash": strings.TrimPrefix(b.hash, "0x"),
+		"time_stamp": b.timestamp,
+	}
+}
+
+func (c *Chain) leader() string {
+	if len(c.preps) > 0 {
+		return c.preps[0]
+	}
+	return client_v1.TreasuryAddress
+}
+
+func (c *Chain) transactionJSON(tx *transaction) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range tx.raw {
+		m[k] = v
+	}
+	b := c.blocks[tx.height]
+	m["blockHeight"] = hexInt64(b.height)
+	m["blockHash"] = b.hash
+	m["txIndex"] = hexInt64(int64(tx.index))
+	return m
+}
+
+func blockHash(b *block) string {
+	buf := []byte(fmt.Sprintf("%d.%s.%d", b.height, b.prevHash, b.timestamp))
+	for _, tx := range b.txs {
+		buf = append(buf, tx.hash...)
+	}
+	return "0x" + hex.EncodeToString(crypto.SHA3Sum256(buf))
+}
+
+func hexInt(v *big.Int) string {
+	return "0x" + v.Text(16)
+}
+
+func hexInt64(v int64) string {
+	return common.HexInt64{Value: v}.String()
+}
@@ -0,0 +1,417 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package emulator serves the parts of the ICON JSON-RPC v3 and debug v3
+// APIs used by rosetta-icon from an in-memory chain, so that the whole
+// service stack can be exercised without an ICON node.
+package emulator
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/icon-project/goloop/common"
+	"github.com/icon-project/goloop/server/jsonrpc"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+)
+
+// Server is an emulated ICON node listening on a local httptest server.
+type Server struct {
+	*Chain
+
+	// AutoProduce makes every accepted transaction produce a new block
+	// right away. Otherwise blocks are produced by calling Produce.
+	AutoProduce bool
+
+	// NoHistory makes balance queries for a past height fail with invalid
+	// params, like nodes which do not keep the state of past blocks.
+	NoHistory bool
+
+	// NoDebug makes the debug API answer with HTTP 404, like public
+	// endpoints which do not expose it.
+	NoDebug bool
+
+	// NoBlockReceipts makes icx_getBlockReceipts fail with method not
+	// found, like old loopchain citizen nodes.
+	NoBlockReceipts bool
+
+	// Goloop makes the blocks after the genesis block use the 2.0 format
+	// of goloop nodes.
+	Goloop bool
+
+	srv *httptest.Server
+}
+
+// NewServer starts an emulated node for network nid. The genesis block
+// gives balances to the given accounts.
+func NewServer(nid int64, balances map[string]*big.Int, preps []string) *Server {
+	s := &Server{
+		Chain:       NewChain(nid, balances, preps),
+		AutoProduce: true,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3", s.serveAPI)
+	mux.HandleFunc("/api/debug/v3", s.serveDebug)
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// Endpoint returns the base URL of the node, as used in ENDPOINT.
+func (s *Server) Endpoint() string {
+	return s.srv.URL
+}
+
+// URL returns the URL of the JSON-RPC v3 API.
+func (s *Server) URL() string {
+	return s.srv.URL + "/api/v3"
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, s.handleAPI)
+}
+
+func (s *Server) serveDebug(w http.ResponseWriter, r *http.Request) {
+	if s.NoDebug {
+		http.NotFound(w, r)
+		return
+	}
+	s.serve(w, r, s.handleDebug)
+}
+
+type handler func(method string, params json.RawMessage) (interface{}, error)
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, h handler) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(nil, jsonrpc.ErrParse(err.Error())))
+		return
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		var reqs []*jsonrpc.Request
+		if err := json.Unmarshal(raw, &reqs); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse(nil, jsonrpc.ErrParse(err.Error())))
+			return
+		}
+		resps := make([]interface{}, len(reqs))
+		for i, req := range reqs {
+			resps[i], _ = s.call(req, h)
+		}
+		writeJSON(w, http.StatusOK, resps)
+		return
+	}
+
+	req := new(jsonrpc.Request)
+	if err := json.Unmarshal(raw, req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(nil, jsonrpc.ErrParse(err.Error())))
+		return
+	}
+	resp, status := s.call(req, h)
+	writeJSON(w, status, resp)
+}
+
+func (s *Server) call(req *jsonrpc.Request, h handler) (interface{}, int) {
+	result, err := h(req.Method, req.Params)
+	if err != nil {
+		jErr, ok := err.(*jsonrpc.Error)
+		if !ok {
+			jErr = jsonrpc.ErrorCodeServer.New(err.Error())
+		}
+		return errorResponse(req.ID, jErr), httpStatus(jErr.Code)
+	}
+	return map[string]interface{}{
+		"jsonrpc": jsonrpc.Version,
+		"id":      req.ID,
+		"result":  result,
+	}, http.StatusOK
+}
+
+func (s *Server) handleAPI(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "icx_getLastBlock":
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		return s.lastBlockJSON(), nil
+
+	case "icx_getBlock":
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		b, err := s.blockByParams(params)
+		if err != nil {
+			return nil, err
+		}
+		if s.Goloop && b.height > 0 {
+			return s.goloopBlockJSON(b), nil
+		}
+		return s.blockJSON(b), nil
+
+	case "icx_getBlockReceipts":
+		if s.NoBlockReceipts {
+			return nil, jsonrpc.ErrMethodNotFound(method)
+		}
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		b, err := s.blockByParams(params)
+		if err != nil {
+			return nil, err
+		}
+		return b.receipts, nil
+
+	case "icx_getTransactionByHash", "icx_getTransactionResult":
+		var req client_v1.TransactionRPCRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+		}
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		tx, ok := s.txs[req.Hash]
+		if !ok {
+			for _, p := range s.pending {
+				if p.hash == req.Hash {
+					return nil, jsonrpc.ErrorCodePending.New("pending")
+				}
+			}
+			return nil, jsonrpc.ErrorCodeNotFound.New("transaction not found")
+		}
+		if method == "icx_getTransactionByHash" {
+			return s.transactionJSON(tx), nil
+		}
+		return s.blocks[tx.height].receipts[tx.index], nil
+
+	case "icx_getTotalSupply":
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		total := new(big.Int)
+		for _, a := range s.accounts {
+			total.Add(total, a.Balance)
+			total.Add(total, a.Stake)
+			total.Add(total, a.Unstake)
+		}
+		return hexInt(total), nil
+
+	case "icx_getBalance":
+		var req client_v1.BalanceRPCRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+		}
+		a, err := s.accountAt(&req)
+		if err != nil {
+			return nil, err
+		}
+		return hexInt(a.Balance), nil
+
+	case "icx_call":
+		return s.callSystem(params)
+
+	case "icx_sendTransaction":
+		hash, err := s.Submit(params)
+		if err != nil {
+			return nil, err
+		}
+		if s.AutoProduce {
+			s.Produce()
+		}
+		return hash, nil
+	}
+	return nil, jsonrpc.ErrMethodNotFound(method)
+}
+
+func (s *Server) handleDebug(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "debug_getAccount":
+		var req client_v1.BalanceRPCRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+		}
+		a, err := s.accountAt(&req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"coin": map[string]interface{}{
+				"type":    "0x0",
+				"balance": hexInt(a.Balance),
+			},
+			"stake": map[string]interface{}{
+				"stake":   hexInt(a.Stake),
+				"unstake": hexInt(a.Unstake),
+			},
+		}, nil
+
+	case "debug_estimateStep":
+		tx, err := client_v1.ParseV3JSON(params)
+		if err != nil {
+			return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+		}
+		return hexInt(EstimateStep(tx)), nil
+	}
+	return nil, jsonrpc.ErrMethodNotFound(method)
+}
+
+// accountAt returns the account of a balance query, at its height if any.
+func (s *Server) accountAt(req *client_v1.BalanceRPCRequest) (*Account, error) {
+	if req.Height == "" {
+		return s.Account(req.Address), nil
+	}
+	if s.NoHistory {
+		return nil, jsonrpc.ErrorCodeInvalidParams.New("height is not supported")
+	}
+	var height common.HexInt64
+	if err := height.UnmarshalJSON([]byte(`"` + req.Height + `"`)); err != nil {
+		return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+	}
+	a, ok := s.AccountAt(req.Address, height.Value)
+	if !ok {
+		return nil, jsonrpc.ErrorCodeNotFound.New("block not found")
+	}
+	return a, nil
+}
+
+// callSystem answers the read-only calls of the system SCORE.
+func (s *Server) callSystem(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		To     string `json:"to"`
+		Height string `json:"height"`
+		Data   struct {
+			Method string            `json:"method"`
+			Params map[string]string `json:"params"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, jsonrpc.ErrorCodeInvalidParams.New(err.Error())
+	}
+	if req.To != client_v1.SystemScoreAddress {
+		if req.Height != "" && s.NoHistory {
+			return nil, jsonrpc.ErrorCodeInvalidParams.New("height is not supported")
+		}
+		return s.callToken(req.To, req.Data.Method, req.Data.Params)
+	}
+
+	switch req.Data.Method {
+	case "getMainPReps":
+		preps := make([]interface{}, len(s.preps))
+		for i, prep := range s.preps {
+			preps[i] = map[string]interface{}{
+				"address": prep,
+			}
+		}
+		return map[string]interface{}{
+			"preps":       preps,
+			"blockHeight": hexInt64(s.Height()),
+		}, nil
+	case "getPRep":
+		address := req.Data.Params["address"]
+		for i, prep := range s.preps {
+			if prep == address {
+				return map[string]interface{}{
+					"address": prep,
+					"name":    "prep" + hexInt64(int64(i)),
+					"grade":   "0x0",
+					"status":  "0x0",
+				}, nil
+			}
+		}
+		return nil, jsonrpc.ErrorCodeScore.New("prep not found")
+	case "getStake", "getDelegation", "getBond":
+		a, err := s.accountAt(&client_v1.BalanceRPCRequest{
+			Address: req.Data.Params["address"],
+			Height:  req.Height,
+		})
+		if err != nil {
+			return nil, err
+		}
+		switch req.Data.Method {
+		case "getStake":
+			unstakes := []interface{}{}
+			if a.Unstake.Sign() > 0 {
+				unstakes = append(unstakes, map[string]interface{}{
+					"unstake":            hexInt(a.Unstake),
+					"unstakeBlockHeight": hexInt64(a.UnlockHeight),
+				})
+			}
+			return map[string]interface{}{
+				"stake":    hexInt(a.Stake),
+				"unstakes": unstakes,
+			}, nil
+		case "getDelegation":
+			return map[string]interface{}{
+				"delegations":    []interface{}{},
+				"totalDelegated": hexInt(a.Delegated),
+				"votingPower":    hexInt(new(big.Int).Sub(a.Stake, a.Delegated)),
+			}, nil
+		default:
+			return map[string]interface{}{
+				"bonds":       []interface{}{},
+				"unbonds":     []interface{}{},
+				"totalBonded": hexInt(a.Bonded),
+			}, nil
+		}
+	}
+	return nil, jsonrpc.ErrorCodeScore.New("method not found")
+}
+
+// callToken answers the read-only calls of a token. Token balances are
+// not kept per block, so calls at a past height see the latest ones.
+func (s *Server) callToken(address string, method string, params map[string]string) (interface{}, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	t, ok := s.tokens[address]
+	if !ok {
+		return nil, jsonrpc.ErrorCodeScore.New("contract not found")
+	}
+	switch method {
+	case "name":
+		return t.Name, nil
+	case "symbol":
+		return t.Symbol, nil
+	case "decimals":
+		return hexInt64(int64(t.Decimals)), nil
+	case "balanceOf":
+		return hexInt(t.balance(params["_owner"])), nil
+	}
+	return nil, jsonrpc.ErrorCodeScore.New("method not found")
+}
+
+func errorResponse(id interface{}, err *jsonrpc.Error) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": jsonrpc.Version,
+		"id":      id,
+		"error":   err,
+	}
+}
+
+// httpStatus follows the status codes ICON nodes use for JSON-RPC errors.
+func httpStatus(code jsonrpc.ErrorCode) int {
+	switch code {
+	case jsonrpc.ErrorCodeInvalidRequest, jsonrpc.ErrorCodeInvalidParams:
+		return http.StatusBadRequest
+	case jsonrpc.ErrorCodeMethodNotFound, jsonrpc.ErrorCodeNotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
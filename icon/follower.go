@@ -0,0 +1,83 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// DefaultFollowInterval is the default delay between two polls of the
+// chain head by the store follower.
+const DefaultFollowInterval = 2 * time.Second
+
+// SetStore makes /block and /block/transaction lookups try store before
+// the block cache and the nodes.
+func (ic *Client) SetStore(store *Store) {
+	ic.store = store
+}
+
+// Follow appends every new block of the chain to the store until ctx is
+// done, polling the chain head every interval. An empty store starts at
+// start, or at the current head when start is negative.
+func (ic *Client) Follow(ctx context.Context, store *Store, start int64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ic.follow(ctx, store, start); err != nil && ctx.Err() == nil {
+			log.Printf("store follower: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ic *Client) follow(ctx context.Context, store *Store, start int64) error {
+	current, _, err := ic.GetLastBlockHeader(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, head, ok, err := store.Range()
+	if err != nil {
+		return err
+	}
+	next := head + 1
+	if !ok {
+		next = start
+		if next < 0 || next > current.Index {
+			next = current.Index
+		}
+	}
+
+	for ; next <= current.Index && ctx.Err() == nil; next++ {
+		index := next
+		block, err := ic.GetBlock(ctx, &RosettaTypes.PartialBlockIdentifier{Index: &index})
+		if err != nil {
+			return err
+		}
+		if err := store.PutBlock(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
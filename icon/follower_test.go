@@ -0,0 +1,213 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/common"
+	"github.com/icon-project/goloop/common/crypto"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"github.com/leeheonseung/rosetta-icon/icon/emulator"
+)
+
+// sendTransfer queues a transfer of value from the account of priv to to
+// on node, and returns its hash.
+func sendTransfer(t *testing.T, node *emulator.Server, priv *crypto.PrivateKey, to string, value int64) string {
+	t.Helper()
+	tx := new(client_v1.Transaction)
+	tx.Version.Value = 3
+	tx.From.SetString(common.NewAccountAddressFromPublicKey(priv.PublicKey()).String())
+	tx.To.SetString(to)
+	tx.Value = common.NewHexInt(value)
+	tx.StepLimit.SetInt64(client_v1.TransferStepCost.Int64())
+	tx.Timestamp.Value = time.Now().UnixNano() / 1000
+	tx.NID = &common.HexInt64{Value: 80}
+	sig, err := crypto.NewSignature(tx.TxHash(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = &common.Signature{Signature: sig}
+
+	js, err := tx.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := node.Submit(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func checkRange(t *testing.T, s *Store, tail int64, head int64) {
+	t.Helper()
+	gotTail, gotHead, ok, err := s.Range()
+	if err != nil || !ok || gotTail != tail || gotHead != head {
+		t.Fatalf("range %d-%d ok=%v err=%v, want %d-%d", gotTail, gotHead, ok, err, tail, head)
+	}
+}
+
+func TestFollowerReachesHeadAndRestarts(t *testing.T) {
+	node := emulator.NewServer(80, nil, nil)
+	defer node.Close()
+	node.AutoProduce = false
+	for i := 0; i < 3; i++ {
+		node.Produce()
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ic := NewClient([]string{node.URL()}, client_v1.ICXCurrency)
+	s := openTestStore(t, dir)
+	if err := ic.follow(ctx, s, 0); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(t, s, 0, 3)
+
+	// At the head, following again adds nothing.
+	if err := ic.follow(ctx, s, 0); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(t, s, 0, 3)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted follower goes on from the stored head, whatever its
+	// start.
+	node.Produce()
+	node.Produce()
+	ic = NewClient([]string{node.URL()}, client_v1.ICXCurrency)
+	s = openTestStore(t, dir)
+	defer s.Close()
+	if err := ic.follow(ctx, s, 4); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(t, s, 0, 5)
+	for i := int64(0); i <= 5; i++ {
+		index := i
+		id := &RosettaTypes.PartialBlockIdentifier{Index: &index}
+		stored, err := s.Block(id)
+		if err != nil || stored == nil {
+			t.Fatalf("block %d not stored: %v", i, err)
+		}
+		block, err := ic.GetBlock(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.BlockIdentifier.Hash != block.BlockIdentifier.Hash {
+			t.Fatalf("stored block %+v, node block %+v", stored.BlockIdentifier, block.BlockIdentifier)
+		}
+	}
+
+	// An empty store started at a negative height starts at the head.
+	head := openTestStore(t, t.TempDir())
+	defer head.Close()
+	if err := ic.follow(ctx, head, -1); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(t, head, 5, 5)
+}
+
+func TestStoreBalanceAt(t *testing.T) {
+	priv, pub := crypto.GenerateKeyPair()
+	sender := common.NewAccountAddressFromPublicKey(pub).String()
+	receiver := "hx0000000000000000000000000000000000000001"
+	initial, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	node := emulator.NewServer(80, map[string]*big.Int{sender: initial}, nil)
+	defer node.Close()
+	node.AutoProduce = false
+	node.Produce()
+	first := sendTransfer(t, node, priv, receiver, 1000)
+	node.Produce()
+	second := sendTransfer(t, node, priv, receiver, 500)
+	node.Produce()
+	ctx := context.Background()
+
+	ic := NewClient([]string{node.URL()}, client_v1.ICXCurrency)
+	s := openTestStore(t, t.TempDir())
+	defer s.Close()
+	if err := ic.follow(ctx, s, 0); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(t, s, 0, 3)
+
+	// The balances summed from the stored operations are the ones of the
+	// node, fees included.
+	for height := int64(0); height <= 3; height++ {
+		for _, address := range []string{sender, receiver} {
+			want, ok := node.AccountAt(address, height)
+			if !ok {
+				t.Fatalf("no block %d", height)
+			}
+			balance, ok, err := s.BalanceAt(address, height, client_v1.ICXCurrency)
+			if err != nil || !ok {
+				t.Fatalf("balance of %s at %d: ok=%v err=%v", address, height, ok, err)
+			}
+			if balance.Cmp(want.Balance) != 0 {
+				t.Errorf("balance of %s at %d is %s, want %s", address, height, balance, want.Balance)
+			}
+		}
+	}
+	if _, ok, err := s.BalanceAt(sender, 4, client_v1.ICXCurrency); ok || err != nil {
+		t.Fatalf("balance beyond the head: ok=%v err=%v", ok, err)
+	}
+
+	// Stored transactions are found by hash, with their block.
+	for height, hash := range map[int64]string{2: first, 3: second} {
+		tx, block, err := s.Transaction(hash)
+		if err != nil || tx == nil {
+			t.Fatalf("transaction %s not stored: %v", hash, err)
+		}
+		if tx.TransactionIdentifier.Hash != hash || block.Index != height {
+			t.Fatalf("transaction %s in block %+v", tx.TransactionIdentifier.Hash, block)
+		}
+	}
+	if tx, block, err := s.Transaction("0x" + strings.Repeat("ab", 32)); tx != nil || block != nil || err != nil {
+		t.Fatalf("unknown transaction found in block %+v: %v", block, err)
+	}
+
+	// A store which does not start at genesis can not sum balances.
+	partial := openTestStore(t, t.TempDir())
+	defer partial.Close()
+	if err := ic.follow(ctx, partial, 1); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(t, partial, 1, 3)
+	if _, ok, err := partial.BalanceAt(receiver, 3, client_v1.ICXCurrency); ok || err != nil {
+		t.Fatalf("balance from a store without genesis: ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+)
+
+const (
+	// DefaultHealthCheckInterval is the default delay between two
+	// health checks of the nodes in a NodePool.
+	DefaultHealthCheckInterval = 10 * time.Second
+
+	// DefaultMaxBlockLag is the default number of blocks a node may
+	// fall behind the highest node before reads avoid it.
+	DefaultMaxBlockLag = int64(3)
+
+	healthCheckTimeout = 5 * time.Second
+)
+
+var errNoNode = errors.New("no ICON node available")
+
+// NodeStatus is the last known state of a node in a NodePool.
+type NodeStatus struct {
+	Endpoint string
+	Primary  bool
+	Healthy  bool
+	Height   int64
+	Latency  time.Duration
+	Checked  time.Time
+}
+
+type node struct {
+	client *client_v1.ClientV3
+
+	mtx    sync.RWMutex
+	status NodeStatus
+}
+
+func (n *node) snapshot() NodeStatus {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	return n.status
+}
+
+func (n *node) markDown() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.status.Healthy = false
+}
+
+func (n *node) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	id, err := n.client.GetLastBlockIdentifier(ctx)
+	latency := time.Since(start)
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.status.Checked = start
+	n.status.Latency = latency
+	n.status.Healthy = err == nil
+	if err == nil {
+		n.status.Height = id.Index
+	}
+}
+
+// NodePool routes requests across several ICON nodes. Reads go to the
+// fastest healthy node which is not lagging behind, and fail over to the
+// remaining nodes. Submits go to the primary node, which is the first
+// endpoint, and fall back to the others only when it is unreachable.
+type NodePool struct {
+	nodes []*node
+
+	// MaxBlockLag is the number of blocks a node may fall behind the
+	// highest node before reads avoid it.
+	MaxBlockLag int64
+
+	// Interval is the delay between two health checks.
+	Interval time.Duration
+}
+
+// NewNodePool creates a pool from endpoints. Every node is assumed to be
+// healthy until the first health check says otherwise.
+func NewNodePool(endpoints []string) *NodePool {
+	nodes := make([]*node, len(endpoints))
+	for i, endpoint := range endpoints {
+		nodes[i] = &node{
+			client: client_v1.NewClientV3(endpoint),
+			status: NodeStatus{
+				Endpoint: endpoint,
+				Primary:  i == 0,
+				Healthy:  true,
+			},
+		}
+	}
+	return &NodePool{
+		nodes:       nodes,
+		MaxBlockLag: DefaultMaxBlockLag,
+		Interval:    DefaultHealthCheckInterval,
+	}
+}
+
+// Clients returns the clients of all nodes, starting with the primary.
+func (p *NodePool) Clients() []*client_v1.ClientV3 {
+	clients := make([]*client_v1.ClientV3, len(p.nodes))
+	for i, n := range p.nodes {
+		clients[i] = n.client
+	}
+	return clients
+}
+
+// Status returns the last known state of every node.
+func (p *NodePool) Status() []NodeStatus {
+	statuses := make([]NodeStatus, len(p.nodes))
+	for i, n := range p.nodes {
+		statuses[i] = n.snapshot()
+	}
+	return statuses
+}
+
+// Height returns the highest block height reported by a healthy node,
+// or 0 before the first health check.
+func (p *NodePool) Height() int64 {
+	var top int64
+	for _, n := range p.nodes {
+		if st := n.snapshot(); st.Healthy && st.Height > top {
+			top = st.Height
+		}
+	}
+	return top
+}
+
+// Monitor checks the health of every node each Interval until ctx is done.
+func (p *NodePool) Monitor(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs a health check against every node concurrently.
+func (p *NodePool) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, n := range p.nodes {
+		wg.Add(1)
+		go func(n *node) {
+			defer wg.Done()
+			n.check(ctx)
+		}(n)
+	}
+	wg.Wait()
+}
+
+// Read calls fn with the preferred node for reads, and with the next
+// one whenever fn fails with a transient error.
+func (p *NodePool) Read(ctx context.Context, fn func(*client_v1.ClientV3) error) error {
+	return p.try(ctx, p.readOrder(), client_v1.IsRetriable, fn)
+}
+
+// ReadDebug calls fn like Read, but only with the nodes which expose the
+// debug API as far as known, and with the next one as well when a node
+// turns out not to expose it.
+func (p *NodePool) ReadDebug(ctx context.Context, fn func(*client_v1.ClientV3) error) error {
+	var order []*node
+	for _, n := range p.readOrder() {
+		if n.client.HasDebug() {
+			order = append(order, n)
+		}
+	}
+	if len(order) == 0 {
+		return fmt.Errorf("%w: no node exposes it", client_v1.ErrDebugUnavailable)
+	}
+	return p.try(ctx, order, client_v1.IsRetriable, fn)
+}
+
+// Submit calls fn with the primary node, and with the next one only
+// when the previous node could not be reached at all.
+func (p *NodePool) Submit(ctx context.Context, fn func(*client_v1.ClientV3) error) error {
+	order := []*node{p.nodes[0]}
+	for _, n := range p.readOrder() {
+		if n != p.nodes[0] {
+			order = append(order, n)
+		}
+	}
+	return p.try(ctx, order, client_v1.IsUnreachable, fn)
+}
+
+func (p *NodePool) try(
+	ctx context.Context,
+	nodes []*node,
+	failover func(error) bool,
+	fn func(*client_v1.ClientV3) error,
+) error {
+	err := errNoNode
+	for _, n := range nodes {
+		err = fn(n.client)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		// A node without the debug API is healthy, and the next one may
+		// have it.
+		if errors.Is(err, client_v1.ErrDebugUnavailable) {
+			continue
+		}
+		if !failover(err) {
+			return err
+		}
+		n.markDown()
+	}
+	return err
+}
+
+// readOrder sorts the nodes by preference: healthy nodes close to the
+// highest block by latency first, then lagging nodes, then unhealthy ones.
+func (p *NodePool) readOrder() []*node {
+	statuses := make(map[*node]NodeStatus, len(p.nodes))
+	var top int64
+	for _, n := range p.nodes {
+		st := n.snapshot()
+		statuses[n] = st
+		if st.Healthy && st.Height > top {
+			top = st.Height
+		}
+	}
+
+	rank := func(st NodeStatus) int {
+		switch {
+		case !st.Healthy:
+			return 2
+		case top-st.Height > p.MaxBlockLag:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	order := make([]*node, len(p.nodes))
+	copy(order, p.nodes)
+	sort.SliceStable(order, func(i, j int) bool {
+		si, sj := statuses[order[i]], statuses[order[j]]
+		if ri, rj := rank(si), rank(sj); ri != rj {
+			return ri < rj
+		}
+		return si.Latency < sj.Latency
+	})
+	return order
+}
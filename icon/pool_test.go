@@ -0,0 +1,166 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"github.com/leeheonseung/rosetta-icon/icon/emulator"
+)
+
+// flakyNode forwards requests to an emulator while it is up, and answers
+// them with HTTP 503 while it is down. It counts the requests it gets.
+type flakyNode struct {
+	*httptest.Server
+	down     int32
+	requests int32
+}
+
+func newFlakyNode(t *testing.T, node *emulator.Server) *flakyNode {
+	target, err := url.Parse(node.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.Path = ""
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	f := new(flakyNode)
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&f.requests, 1)
+		if atomic.LoadInt32(&f.down) != 0 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	return f
+}
+
+func (f *flakyNode) setDown(down bool) {
+	var v int32
+	if down {
+		v = 1
+	}
+	atomic.StoreInt32(&f.down, v)
+}
+
+func newTestPool(endpoints ...string) *NodePool {
+	p := NewNodePool(endpoints)
+	for _, c := range p.Clients() {
+		c.Retry = client_v1.NewRetryPolicy(1, 0)
+	}
+	return p
+}
+
+func readHeight(t *testing.T, p *NodePool) int64 {
+	t.Helper()
+	var height int64
+	err := p.Read(context.Background(), func(c *client_v1.ClientV3) error {
+		id, err := c.GetLastBlockIdentifier(context.Background())
+		if err != nil {
+			return err
+		}
+		height = id.Index
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return height
+}
+
+func TestNodePoolFailsOverAndRecovers(t *testing.T) {
+	node := emulator.NewServer(80, nil, nil)
+	defer node.Close()
+	node.AutoProduce = false
+	node.Produce()
+
+	flaky := newFlakyNode(t, node)
+	defer flaky.Close()
+	flaky.setDown(true)
+
+	p := newTestPool(flaky.URL+"/api/v3", node.URL())
+
+	// Reads fail over to the node which is up, and mark the node which is
+	// down unhealthy, so that later reads avoid it.
+	if height := readHeight(t, p); height != 1 {
+		t.Fatalf("read height %d", height)
+	}
+	if st := p.Status(); st[0].Healthy || !st[1].Healthy {
+		t.Fatalf("status after failover %+v", st)
+	}
+	readHeight(t, p)
+	if n := atomic.LoadInt32(&flaky.requests); n != 1 {
+		t.Fatalf("%d requests to the node which is down", n)
+	}
+
+	p.Check(context.Background())
+	if st := p.Status(); st[0].Healthy || !st[1].Healthy || st[1].Height != 1 {
+		t.Fatalf("status while down %+v", st)
+	}
+	if height := p.Height(); height != 1 {
+		t.Fatalf("pool height %d", height)
+	}
+
+	// The next health check finds the node up again.
+	flaky.setDown(false)
+	p.Check(context.Background())
+	if st := p.Status(); !st[0].Healthy || st[0].Height != 1 || !st[1].Healthy {
+		t.Fatalf("status after recovery %+v", st)
+	}
+}
+
+func TestNodePoolSubmitFailsOverOnlyWhenUnreachable(t *testing.T) {
+	node := emulator.NewServer(80, nil, nil)
+	defer node.Close()
+	node.AutoProduce = false
+	node.Produce()
+
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	flaky := newFlakyNode(t, node)
+	defer flaky.Close()
+	flaky.setDown(true)
+
+	submit := func(p *NodePool) (string, error) {
+		var endpoint string
+		err := p.Submit(context.Background(), func(c *client_v1.ClientV3) error {
+			endpoint = c.Endpoint
+			_, err := c.GetLastBlockIdentifier(context.Background())
+			return err
+		})
+		return endpoint, err
+	}
+
+	// A primary which can not be reached is skipped.
+	endpoint, err := submit(newTestPool(down.URL+"/api/v3", node.URL()))
+	if err != nil || endpoint != node.URL() {
+		t.Fatalf("submitted to %s: %v", endpoint, err)
+	}
+
+	// A primary which was reached is not, since it may have accepted the
+	// transaction.
+	endpoint, err = submit(newTestPool(flaky.URL+"/api/v3", node.URL()))
+	if err == nil || endpoint != flaky.URL+"/api/v3" {
+		t.Fatalf("submitted to %s: %v", endpoint, err)
+	}
+}
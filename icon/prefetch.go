@@ -0,0 +1,143 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// DefaultPrefetchDepth is the default number of blocks fetched
+	// ahead of a sequential reader.
+	DefaultPrefetchDepth = 16
+
+	// DefaultPrefetchWorkers is the default number of blocks fetched
+	// concurrently by the prefetcher.
+	DefaultPrefetchWorkers = 4
+
+	prefetchTimeout = 30 * time.Second
+)
+
+type fetch struct {
+	done  chan struct{}
+	block *RosettaTypes.Block
+	err   error
+}
+
+// prefetcher detects blocks being requested in ascending height order and
+// fetches the following blocks into the block cache before they are asked
+// for. Requests for a block being prefetched wait for it instead of
+// fetching it a second time.
+type prefetcher struct {
+	depth   int64
+	workers chan struct{}
+
+	mtx      sync.Mutex
+	last     int64
+	inflight map[int64]*fetch
+}
+
+func newPrefetcher(depth int, workers int) *prefetcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &prefetcher{
+		depth:    int64(depth),
+		workers:  make(chan struct{}, workers),
+		last:     -1,
+		inflight: map[int64]*fetch{},
+	}
+}
+
+// wait returns the block at height if it is being prefetched. Every
+// waiter gets a copy of its own of the fetched block.
+func (p *prefetcher) wait(ctx context.Context, height int64) (*RosettaTypes.Block, bool) {
+	p.mtx.Lock()
+	f, ok := p.inflight[height]
+	p.mtx.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, false
+		}
+		b, err := json.Marshal(f.block)
+		if err != nil {
+			return nil, false
+		}
+		block, err := decodeCachedBlock(b)
+		return block, err == nil
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// observe records a request for the block at height. When it follows the
+// previous request, the next blocks up to tip which are not cached yet are
+// fetched in the background. Nothing is fetched while the tip is unknown,
+// which it is until the first health check of the nodes.
+func (p *prefetcher) observe(ic *Client, height int64, tip int64) {
+	if p.depth <= 0 {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	sequential := height == p.last+1
+	if height > p.last {
+		p.last = height
+	}
+	if !sequential || tip <= 0 {
+		return
+	}
+
+	for h := height + 1; h <= height+p.depth && h <= tip; h++ {
+		if _, ok := p.inflight[h]; ok || ic.cache.Has(h) {
+			continue
+		}
+		f := &fetch{done: make(chan struct{})}
+		p.inflight[h] = f
+		go p.run(ic, h, f)
+	}
+}
+
+func (p *prefetcher) run(ic *Client, height int64, f *fetch) {
+	defer func() {
+		p.mtx.Lock()
+		delete(p.inflight, height)
+		p.mtx.Unlock()
+		close(f.done)
+	}()
+
+	p.workers <- struct{}{}
+	defer func() { <-p.workers }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+	defer cancel()
+
+	f.block, f.err = ic.fetchBlock(ctx, &RosettaTypes.PartialBlockIdentifier{Index: &height})
+	if f.err == nil {
+		ic.cache.Add(f.block)
+	}
+}
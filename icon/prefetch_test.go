@@ -0,0 +1,63 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"sort"
+	"testing"
+)
+
+func inflightHeights(p *prefetcher) []int64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var heights []int64
+	for h := range p.inflight {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights
+}
+
+func TestPrefetchUnknownTip(t *testing.T) {
+	ic := newReplayClient()
+	p := newPrefetcher(DefaultPrefetchDepth, DefaultPrefetchWorkers)
+	p.observe(ic, 0, 0)
+	p.observe(ic, 1, 0)
+	if heights := inflightHeights(p); len(heights) != 0 {
+		t.Fatalf("prefetching %v without a tip", heights)
+	}
+}
+
+func TestPrefetchClampsAtTip(t *testing.T) {
+	ic := newReplayClient()
+	p := newPrefetcher(DefaultPrefetchDepth, DefaultPrefetchWorkers)
+	p.observe(ic, 0, 2)
+
+	heights := inflightHeights(p)
+	if len(heights) != 2 || heights[0] != 1 || heights[1] != 2 {
+		t.Fatalf("prefetching %v, want [1 2]", heights)
+	}
+	for _, h := range heights {
+		// A fetch which already finished is no longer waited for.
+		if block, ok := p.wait(context.Background(), h); ok && block.BlockIdentifier.Index != h {
+			t.Fatalf("prefetched block %d for %d", block.BlockIdentifier.Index, h)
+		}
+		if !ic.cache.Has(h) {
+			t.Fatalf("block %d not cached", h)
+		}
+	}
+}
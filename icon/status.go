@@ -0,0 +1,167 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultPeerTTL is the default duration the P-Rep list is
+	// served from memory before it is fetched again.
+	DefaultPeerTTL = time.Minute
+
+	peerRefreshTimeout = 30 * time.Second
+)
+
+// statusCache keeps what /network/status needs apart from the latest
+// block: the genesis block identifier, which never changes, and the
+// P-Rep list, which is refreshed in the background once it is older
+// than ttl. Concurrent callers on a cold cache share a single fetch.
+type statusCache struct {
+	ttl   time.Duration
+	group singleflight.Group
+
+	mtx        sync.Mutex
+	genesis    *RosettaTypes.BlockIdentifier
+	peers      []*RosettaTypes.Peer
+	fetched    time.Time
+	refreshing bool
+}
+
+func newStatusCache(ttl time.Duration) *statusCache {
+	return &statusCache{ttl: ttl}
+}
+
+// SetPeerTTL sets how long the P-Rep list is served from memory.
+func (ic *Client) SetPeerTTL(ttl time.Duration) {
+	ic.status.mtx.Lock()
+	defer ic.status.mtx.Unlock()
+	ic.status.ttl = ttl
+}
+
+// GetGenesisBlockIdentifier returns the identifier of the genesis block,
+// which is only fetched once.
+func (ic *Client) GetGenesisBlockIdentifier(ctx context.Context) (*RosettaTypes.BlockIdentifier, error) {
+	ic.status.mtx.Lock()
+	genesis := ic.status.genesis
+	ic.status.mtx.Unlock()
+	if genesis != nil {
+		return genesis, nil
+	}
+
+	v, err, _ := ic.status.group.Do("genesis", func() (interface{}, error) {
+		err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+			header, err := c.GetBlockHeader(ctx, &client_v1.BlockRPCRequest{Height: "0x0"})
+			if err != nil {
+				return fmt.Errorf("%w: could not get genesis block", err)
+			}
+			genesis = header.Identifier()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ic.status.mtx.Lock()
+		ic.status.genesis = genesis
+		ic.status.mtx.Unlock()
+		return genesis, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*RosettaTypes.BlockIdentifier), nil
+}
+
+// GetLastBlockHeader returns the identifier and the timestamp in
+// milliseconds of the latest block, without parsing its transactions.
+// The JSON-RPC API has no call for the header alone, so the node still
+// sends the whole block.
+func (ic *Client) GetLastBlockHeader(ctx context.Context) (*RosettaTypes.BlockIdentifier, int64, error) {
+	var header *client_v1.BlockHeader
+	err := ic.pool.Read(ctx, func(c *client_v1.ClientV3) error {
+		var err error
+		header, err = c.GetLastBlockHeader(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: could not get last block", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return header.Identifier(), header.TimestampMilli(), nil
+}
+
+// GetCachedPeer returns the P-Rep list of GetPeer from memory. It is only
+// fetched synchronously the first time, once for all concurrent callers.
+// Afterwards an outdated list is returned while a fresh one is fetched in
+// the background.
+func (ic *Client) GetCachedPeer(ctx context.Context) ([]*RosettaTypes.Peer, error) {
+	st := ic.status
+	st.mtx.Lock()
+	if st.peers == nil {
+		st.mtx.Unlock()
+		v, err, _ := st.group.Do("peers", func() (interface{}, error) {
+			peers, err := ic.GetPeer(ctx)
+			if err != nil {
+				return nil, err
+			}
+			st.setPeers(peers)
+			return peers, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.([]*RosettaTypes.Peer), nil
+	}
+	defer st.mtx.Unlock()
+
+	if time.Since(st.fetched) > st.ttl && !st.refreshing {
+		st.refreshing = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), peerRefreshTimeout)
+			defer cancel()
+
+			peers, err := ic.GetPeer(ctx)
+			st.mtx.Lock()
+			st.refreshing = false
+			st.mtx.Unlock()
+			if err == nil {
+				st.setPeers(peers)
+			}
+		}()
+	}
+	return st.peers, nil
+}
+
+func (st *statusCache) setPeers(peers []*RosettaTypes.Peer) {
+	if peers == nil {
+		peers = []*RosettaTypes.Peer{}
+	}
+
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	st.peers = peers
+	st.fetched = time.Now()
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"github.com/leeheonseung/rosetta-icon/icon/emulator"
+)
+
+func TestCachedPeerFetchedOnce(t *testing.T) {
+	node := emulator.NewServer(80, nil, []string{
+		"hx1111111111111111111111111111111111111111",
+		"hx1111111111111111111111111111111111111112",
+	})
+	defer node.Close()
+
+	// The node holds the P-Rep list requests until all callers wait for
+	// the list.
+	target, err := url.Parse(node.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.Path = ""
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	var fetches int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if bytes.Contains(b, []byte("getMainPReps")) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+
+	ic := NewClient([]string{slow.URL + "/api/v3"}, client_v1.ICXCurrency)
+	ic.SetRetryPolicy(client_v1.NewRetryPolicy(1, 0))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			peers, err := ic.GetCachedPeer(context.Background())
+			if err == nil && len(peers) != 2 {
+				t.Errorf("%d peers", len(peers))
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("P-Rep list fetched %d times", n)
+	}
+}
+
+func TestGenesisBlockIdentifier(t *testing.T) {
+	node := emulator.NewServer(80, nil, nil)
+	defer node.Close()
+
+	ic := NewClient([]string{node.URL()}, client_v1.ICXCurrency)
+	genesis, err := ic.GetGenesisBlockIdentifier(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := int64(0)
+	block, err := ic.GetBlock(context.Background(), &RosettaTypes.PartialBlockIdentifier{Index: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Index != 0 || genesis.Hash != block.BlockIdentifier.Hash {
+		t.Fatalf("genesis %+v, block %+v", genesis, block.BlockIdentifier)
+	}
+}
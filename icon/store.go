@@ -0,0 +1,288 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"path/filepath"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Key prefixes of the store.
+var (
+	blockPrefix     = []byte("b") // height -> block
+	blockHashPrefix = []byte("h") // block hash -> height
+	txPrefix        = []byte("t") // transaction hash -> height
+	accountPrefix   = []byte("a") // address/height/tx/op -> OperationRef
+	metaPrefix      = []byte("m") // name -> metadata of the store
+
+	// The range of stored heights is kept under its own prefix, apart
+	// from the indexes whose keys start with the same letters.
+	headKey = key(metaPrefix, []byte("head"))
+	tailKey = key(metaPrefix, []byte("tail"))
+)
+
+// OperationRef locates an operation touching an account, along with the
+// amount it moved.
+type OperationRef struct {
+	Block       *RosettaTypes.BlockIdentifier       `json:"block_identifier"`
+	Transaction *RosettaTypes.TransactionIdentifier `json:"transaction_identifier"`
+	Operation   *RosettaTypes.OperationIdentifier   `json:"operation_identifier"`
+	Status      string                              `json:"status"`
+	Amount      *RosettaTypes.Amount                `json:"amount,omitempty"`
+}
+
+// Store persists parsed blocks on disk, together with indexes from
+// block and transaction hashes to heights and from accounts to the
+// operations touching them. It holds the contiguous range of blocks
+// between its tail and its head.
+type Store struct {
+	db *leveldb.DB
+}
+
+// OpenStore opens the store in dir, creating it if needed.
+func OpenStore(dir string) (*Store, error) {
+	db, err := leveldb.OpenFile(filepath.Join(dir, "blocks"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to open store in %s", err, dir)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Range returns the lowest and the highest stored heights. ok is false
+// while the store is empty.
+func (s *Store) Range() (tail int64, head int64, ok bool, err error) {
+	if tail, ok, err = s.height(tailKey); !ok || err != nil {
+		return
+	}
+	head, ok, err = s.height(headKey)
+	return
+}
+
+// PutBlock stores block and indexes its transactions and operations. The
+// block must directly follow the head of the store, unless the store is
+// empty.
+func (s *Store) PutBlock(block *RosettaTypes.Block) error {
+	index := block.BlockIdentifier.Index
+	_, head, ok, err := s.Range()
+	if err != nil {
+		return err
+	}
+	if ok && index != head+1 {
+		return fmt.Errorf("block %d does not follow stored head %d", index, head)
+	}
+
+	b, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	height := heightBytes(index)
+
+	batch := new(leveldb.Batch)
+	batch.Put(key(blockPrefix, height), b)
+	batch.Put(key(blockHashPrefix, []byte(client_v1.NormalizeHash(block.BlockIdentifier.Hash))), height)
+	for i, tx := range block.Transactions {
+		batch.Put(key(txPrefix, []byte(client_v1.NormalizeHash(tx.TransactionIdentifier.Hash))), height)
+		for _, op := range tx.Operations {
+			if op.Account == nil {
+				continue
+			}
+			ref, err := json.Marshal(&OperationRef{
+				Block:       block.BlockIdentifier,
+				Transaction: tx.TransactionIdentifier,
+				Operation:   op.OperationIdentifier,
+				Status:      op.Status,
+				Amount:      op.Amount,
+			})
+			if err != nil {
+				return err
+			}
+			pos := make([]byte, 16)
+			binary.BigEndian.PutUint32(pos[8:], uint32(i))
+			binary.BigEndian.PutUint32(pos[12:], uint32(op.OperationIdentifier.Index))
+			copy(pos, height)
+			batch.Put(key(accountPrefix, accountKey(op.Account.Address), pos), ref)
+		}
+	}
+	if !ok {
+		batch.Put(tailKey, height)
+	}
+	batch.Put(headKey, height)
+	return s.db.Write(batch, nil)
+}
+
+// Block returns the stored block matching id, or nil if it is not stored.
+func (s *Store) Block(id *RosettaTypes.PartialBlockIdentifier) (*RosettaTypes.Block, error) {
+	if id == nil || (id.Index == nil && id.Hash == nil) {
+		return nil, nil
+	}
+
+	var height []byte
+	if id.Index != nil {
+		height = heightBytes(*id.Index)
+	} else {
+		var err error
+		height, err = s.get(key(blockHashPrefix, []byte(client_v1.NormalizeHash(*id.Hash))))
+		if height == nil || err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := s.get(key(blockPrefix, height))
+	if b == nil || err != nil {
+		return nil, err
+	}
+	block := new(RosettaTypes.Block)
+	if err := json.Unmarshal(b, block); err != nil {
+		return nil, err
+	}
+	if id.Hash != nil && client_v1.NormalizeHash(block.BlockIdentifier.Hash) != client_v1.NormalizeHash(*id.Hash) {
+		return nil, nil
+	}
+	return block, nil
+}
+
+// Transaction returns the stored transaction with the given hash and the
+// block including it, or nil if it is not stored.
+func (s *Store) Transaction(hash string) (*RosettaTypes.Transaction, *RosettaTypes.BlockIdentifier, error) {
+	height, err := s.get(key(txPrefix, []byte(client_v1.NormalizeHash(hash))))
+	if height == nil || err != nil {
+		return nil, nil, err
+	}
+	index := int64(binary.BigEndian.Uint64(height))
+	block, err := s.Block(&RosettaTypes.PartialBlockIdentifier{Index: &index})
+	if block == nil || err != nil {
+		return nil, nil, err
+	}
+	for _, tx := range block.Transactions {
+		if client_v1.NormalizeHash(tx.TransactionIdentifier.Hash) == client_v1.NormalizeHash(hash) {
+			return tx, block.BlockIdentifier, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// AccountOperations returns the stored operations touching address, in
+// chain order.
+func (s *Store) AccountOperations(address string) ([]*OperationRef, error) {
+	it := s.db.NewIterator(util.BytesPrefix(key(accountPrefix, accountKey(address))), nil)
+	defer it.Release()
+
+	var refs []*OperationRef
+	for it.Next() {
+		ref := new(OperationRef)
+		if err := json.Unmarshal(it.Value(), ref); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, it.Error()
+}
+
+// BalanceAt sums the successful operations in currency touching address
+// up to the block at height. ok is false unless the store holds every
+// block from genesis up to height, which the sum needs to be complete.
+func (s *Store) BalanceAt(
+	address string,
+	height int64,
+	currency *RosettaTypes.Currency,
+) (balance *big.Int, ok bool, err error) {
+	tail, head, ok, err := s.Range()
+	if !ok || err != nil || tail != 0 || head < height {
+		return nil, false, err
+	}
+
+	prefix := key(accountPrefix, accountKey(address))
+	it := s.db.NewIterator(&util.Range{
+		Start: prefix,
+		Limit: key(prefix, heightBytes(height+1)),
+	}, nil)
+	defer it.Release()
+
+	balance = new(big.Int)
+	for it.Next() {
+		ref := new(OperationRef)
+		if err := json.Unmarshal(it.Value(), ref); err != nil {
+			return nil, false, err
+		}
+		if ref.Status != client_v1.SuccessStatus || ref.Amount == nil ||
+			!sameCurrency(ref.Amount.Currency, currency) {
+			continue
+		}
+		value, valid := new(big.Int).SetString(ref.Amount.Value, 10)
+		if !valid {
+			return nil, false, fmt.Errorf("invalid amount %s", ref.Amount.Value)
+		}
+		balance.Add(balance, value)
+	}
+	if err := it.Error(); err != nil {
+		return nil, false, err
+	}
+	return balance, true, nil
+}
+
+// sameCurrency tells ICX and the IRC2 tokens apart by their contract,
+// as tokens may use any symbol.
+func sameCurrency(a *RosettaTypes.Currency, b *RosettaTypes.Currency) bool {
+	return a != nil && a.Symbol == b.Symbol &&
+		a.Metadata[client_v1.ContractAddressKey] == b.Metadata[client_v1.ContractAddressKey]
+}
+
+func (s *Store) height(k []byte) (int64, bool, error) {
+	b, err := s.get(k)
+	if b == nil || err != nil {
+		return 0, false, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), true, nil
+}
+
+func (s *Store) get(k []byte) ([]byte, error) {
+	b, err := s.db.Get(k, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return b, err
+}
+
+func key(parts ...[]byte) []byte {
+	var k []byte
+	for _, part := range parts {
+		k = append(k, part...)
+	}
+	return k
+}
+
+func heightBytes(height int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(height))
+	return b
+}
+
+// accountKey terminates the address, so that no address is a prefix of
+// another one.
+func accountKey(address string) []byte {
+	return append([]byte(address), '/')
+}
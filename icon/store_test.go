@@ -0,0 +1,61 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icon
+
+import (
+	"fmt"
+	"testing"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestStoreKeysStayInTheirPrefix(t *testing.T) {
+	s, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := int64(10); i < 13; i++ {
+		block := cacheTestBlock()
+		block.BlockIdentifier = &RosettaTypes.BlockIdentifier{Index: i, Hash: fmt.Sprintf("0xead%x", i)}
+		block.Transactions[0].TransactionIdentifier.Hash = fmt.Sprintf("0xa1%x", i)
+		if err := s.PutBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tail, head, ok, err := s.Range()
+	if err != nil || !ok || tail != 10 || head != 12 {
+		t.Fatalf("range %d-%d ok=%v err=%v", tail, head, ok, err)
+	}
+
+	// The range is not among the block and transaction hashes.
+	for _, prefix := range [][]byte{blockHashPrefix, txPrefix} {
+		it := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+		n := 0
+		for it.Next() {
+			if len(it.Value()) != 8 {
+				t.Errorf("%q is not a height index", it.Key())
+			}
+			n++
+		}
+		it.Release()
+		if n != 3 {
+			t.Errorf("%d keys under %q", n, prefix)
+		}
+	}
+}
@@ -15,10 +15,18 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/coinbase/rosetta-sdk-go/asserter"
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/leeheonseung/rosetta-icon/configuration"
 	"github.com/leeheonseung/rosetta-icon/icon"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
 )
 
 type AccountAPIService struct {
@@ -45,10 +53,69 @@ func (s *AccountAPIService) AccountBalance(
 		return nil, ErrUnavailableOffline
 	}
 
-	balance, err := s.client.GetBalance(request.AccountIdentifier)
+	currencies := requestCurrencies(ctx)
+	for _, currency := range currencies {
+		if err := asserter.Currency(currency); err != nil {
+			return nil, wrapErr(ErrUnsupportedCurrency, err)
+		}
+	}
 
+	balance, err := s.client.GetBalance(ctx, request.AccountIdentifier, request.BlockIdentifier, currencies)
+	if errors.Is(err, client_v1.ErrUnsupportedCurrency) {
+		return nil, wrapErr(ErrUnsupportedCurrency, err)
+	}
+	if errors.Is(err, icon.ErrHistoricalBalanceUnavailable) {
+		return nil, wrapErr(ErrHistoricalBalanceUnavailable, err)
+	}
+	if errors.Is(err, client_v1.ErrUnknownSubAccount) {
+		return nil, wrapErr(ErrUnknownSubAccount, err)
+	}
+	if errors.Is(err, icon.ErrBlockNotFound) {
+		return nil, wrapErr(ErrBlockNotFound, err)
+	}
 	if err != nil {
-		return nil, wrapErr(ErrInvalidAddress, err)
+		return nil, nodeErr(ErrInvalidAddress, err)
 	}
 	return balance, nil
 }
+
+type currenciesKey struct{}
+
+// maxBalanceRequestSize bounds the /account/balance bodies read by
+// withCurrencies.
+const maxBalanceRequestSize = 1 << 20
+
+// withCurrencies passes the currencies of /account/balance requests to
+// AccountAPIService in the request context, as rosetta-sdk-go v0.5.5 does
+// not decode them. It can go once the SDK is bumped to a release whose
+// AccountBalanceRequest has Currencies.
+func withCurrencies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/account/balance" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBalanceRequestSize))
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var request struct {
+			Currencies []*types.Currency `json:"currencies"`
+		}
+		if json.Unmarshal(body, &request) == nil && len(request.Currencies) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), currenciesKey{}, request.Currencies))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestCurrencies returns the currencies of the /account/balance
+// request served with ctx.
+func requestCurrencies(ctx context.Context) []*types.Currency {
+	currencies, _ := ctx.Value(currenciesKey{}).([]*types.Currency)
+	return currencies
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestWithCurrencies(t *testing.T) {
+	var (
+		currencies []*types.Currency
+		body       []byte
+		called     bool
+	)
+	h := withCurrencies(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		currencies = requestCurrencies(r.Context())
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	serve := func(path string, req string) int {
+		called, currencies, body = false, nil, nil
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(req)))
+		return w.Code
+	}
+
+	req := `{"account_identifier":{"address":"hx0000000000000000000000000000000000000001"},` +
+		`"currencies":[{"symbol":"TAP","decimals":18,"metadata":{"contract_address":"cx1111111111111111111111111111111111111111"}}]}`
+	if code := serve("/account/balance", req); code != http.StatusOK || !called {
+		t.Fatalf("status %d, called %v", code, called)
+	}
+	if len(currencies) != 1 || currencies[0].Symbol != "TAP" {
+		t.Fatalf("currencies %s", types.PrettyPrintStruct(currencies))
+	}
+	if !bytes.Equal(body, []byte(req)) {
+		t.Fatalf("body %s", body)
+	}
+
+	// Other endpoints are left alone, whatever their body.
+	if code := serve("/block", req); code != http.StatusOK || !called || currencies != nil {
+		t.Fatalf("status %d, called %v, currencies %v", code, called, currencies)
+	}
+
+	// Bodies over the limit are rejected before they reach the service.
+	large := `{"currencies":[],"padding":"` + strings.Repeat("a", maxBalanceRequestSize) + `"}`
+	if code := serve("/account/balance", large); code != http.StatusRequestEntityTooLarge || called {
+		t.Fatalf("status %d, called %v", code, called)
+	}
+}
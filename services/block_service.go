@@ -16,6 +16,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/leeheonseung/rosetta-icon/configuration"
 	"github.com/leeheonseung/rosetta-icon/icon"
@@ -45,9 +46,9 @@ func (s *BlockAPIService) Block(
 		return nil, ErrUnavailableOffline
 	}
 
-	block, err := s.client.GetBlock(request.BlockIdentifier)
+	block, err := s.client.GetBlock(ctx, request.BlockIdentifier)
 	if err != nil {
-		return nil, wrapErr(ErrWrongBlockHash, err)
+		return nil, nodeErr(ErrBlockNotFound, err)
 	}
 	return &types.BlockResponse{
 		Block: block,
@@ -63,10 +64,13 @@ func (s *BlockAPIService) BlockTransaction(
 		return nil, ErrUnavailableOffline
 	}
 
-	tx, err := s.client.GetTransaction(request.TransactionIdentifier)
-	if err != nil {
+	tx, err := s.client.GetBlockTransaction(ctx, request.BlockIdentifier, request.TransactionIdentifier)
+	if errors.Is(err, icon.ErrWrongBlock) {
 		return nil, wrapErr(ErrWrongBlockHash, err)
 	}
+	if err != nil {
+		return nil, nodeErr(ErrTransactionNotFound, err)
+	}
 
 	return &types.BlockTransactionResponse{
 		Transaction: tx,
@@ -18,6 +18,7 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/icon-project/goloop/common"
 	"github.com/icon-project/goloop/common/crypto"
@@ -249,9 +250,12 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 		uTx.Data = bs
 	}
 
-	res, err := s.client.EstimateStep(*uTx)
+	res, err := s.client.EstimateStep(ctx, *uTx)
+	if errors.Is(err, client_v1.ErrDebugUnavailable) {
+		return nil, wrapErr(ErrStepEstimationUnavailable, err)
+	}
 	if err != nil {
-		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+		return nil, nodeErr(ErrUnclearIntent, err)
 	}
 	var step common.HexInt
 	if err = json.Unmarshal(res.Result, &step); err != nil {
@@ -427,8 +431,8 @@ func (s *ConstructionAPIService) ConstructionSubmit(
 		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 
-	if err := s.client.SendTransaction(*signedTx); err != nil {
-		return nil, wrapErr(ErrBroadcastFailed, err)
+	if err := s.client.SendTransaction(ctx, *signedTx); err != nil {
+		return nil, nodeErr(ErrBroadcastFailed, err)
 	}
 
 	h := "0x" + hex.EncodeToString(signedTx.TxHash())
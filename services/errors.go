@@ -15,7 +15,11 @@
 package services
 
 import (
+	"context"
+	"errors"
+
 	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
 )
 
 var (
@@ -25,7 +29,31 @@ var (
 		ErrUnimplemented,
 		ErrUnavailableOffline,
 		ErrNotReady,
+		ErrUnableToDecompressPubkey,
+		ErrUnclearIntent,
+		ErrUnableToParseIntermediateResult,
+		ErrSignatureInvalid,
+		ErrBroadcastFailed,
+		ErrInvalidAddress,
 		ErrWrongBlockHash,
+		ErrBlockNotFound,
+		ErrTransactionNotFound,
+		ErrTransactionPending,
+		ErrTransactionExecuting,
+		ErrNodeTimeout,
+		ErrNodeInternal,
+		ErrNodeHTTP,
+		ErrNodeUnavailable,
+		ErrMethodNotSupported,
+		ErrScoreFailure,
+		ErrInvalidNodeResponse,
+		ErrHistoricalBalanceUnavailable,
+		ErrUnstableHead,
+		ErrUnknownSubAccount,
+		ErrStepEstimationUnavailable,
+		ErrUnsupportedCurrency,
+		ErrReceiptMismatch,
+		ErrNodeHTTPUnavailable,
 	}
 
 	// ErrUnimplemented is returned when an endpoint
@@ -95,19 +123,165 @@ var (
 		Message: "Invalid address",
 	}
 
-	// ErrNotReady is returned when ICON Node is not
-	// yet ready to serve queries.
+	// ErrWrongBlockHash is returned when a transaction
+	// is not part of the requested block.
 	ErrWrongBlockHash = &types.Error{
 		Code:      13,
 		Message:   "Wrong Block Hash",
 		Retriable: true,
 	}
+
+	// ErrBlockNotFound is returned when ICON Node
+	// does not know the requested block.
+	ErrBlockNotFound = &types.Error{
+		Code:    14, //nolint
+		Message: "Block not found",
+	}
+
+	// ErrTransactionNotFound is returned when ICON Node
+	// does not know the requested transaction.
+	ErrTransactionNotFound = &types.Error{
+		Code:    15, //nolint
+		Message: "Transaction not found",
+	}
+
+	// ErrTransactionPending is returned when the requested
+	// transaction is still in the transaction pool.
+	ErrTransactionPending = &types.Error{
+		Code:      16, //nolint
+		Message:   "Transaction is pending",
+		Retriable: true,
+	}
+
+	// ErrTransactionExecuting is returned when the requested
+	// transaction is included but not executed yet.
+	ErrTransactionExecuting = &types.Error{
+		Code:      17, //nolint
+		Message:   "Transaction is executing",
+		Retriable: true,
+	}
+
+	// ErrNodeTimeout is returned when ICON Node
+	// does not answer in time.
+	ErrNodeTimeout = &types.Error{
+		Code:      18, //nolint
+		Message:   "ICON Node timeout",
+		Retriable: true,
+	}
+
+	// ErrNodeInternal is returned when ICON Node
+	// fails with a server error.
+	ErrNodeInternal = &types.Error{
+		Code:      19, //nolint
+		Message:   "ICON Node internal error",
+		Retriable: true,
+	}
+
+	// ErrNodeHTTP is returned when ICON Node answers
+	// with an HTTP error instead of a JSON-RPC response,
+	// other than a server error or too many requests.
+	ErrNodeHTTP = &types.Error{
+		Code:    20, //nolint
+		Message: "ICON Node HTTP error",
+	}
+
+	// ErrNodeUnavailable is returned when ICON Node
+	// cannot be reached.
+	ErrNodeUnavailable = &types.Error{
+		Code:      21, //nolint
+		Message:   "ICON Node unavailable",
+		Retriable: true,
+	}
+
+	// ErrMethodNotSupported is returned when ICON Node
+	// does not support a method the request needs.
+	ErrMethodNotSupported = &types.Error{
+		Code:    22, //nolint
+		Message: "Method not supported by ICON Node",
+	}
+
+	// ErrScoreFailure is returned when a SCORE call
+	// fails on ICON Node.
+	ErrScoreFailure = &types.Error{
+		Code:    23, //nolint
+		Message: "SCORE execution failed",
+	}
+
+	// ErrInvalidNodeResponse is returned when a response
+	// of ICON Node cannot be parsed.
+	ErrInvalidNodeResponse = &types.Error{
+		Code:    24, //nolint
+		Message: "Unable to parse ICON Node response",
+	}
+
+	// ErrHistoricalBalanceUnavailable is returned when
+	// the balance at a past block can neither be read
+	// from ICON Node nor rebuilt from stored blocks.
+	ErrHistoricalBalanceUnavailable = &types.Error{
+		Code:    25, //nolint
+		Message: "Historical balance unavailable",
+	}
+
+	// ErrUnstableHead is returned when a balance could
+	// not be tied to a block because new blocks kept
+	// landing while it was read.
+	ErrUnstableHead = &types.Error{
+		Code:      26, //nolint
+		Message:   "Chain head moved while reading balance",
+		Retriable: true,
+	}
+
+	// ErrUnknownSubAccount is returned when a balance
+	// is requested for a sub-account other than liquid,
+	// stake, unstake, delegated or bonded.
+	ErrUnknownSubAccount = &types.Error{
+		Code:    27, //nolint
+		Message: "Unknown sub-account",
+	}
+
+	// ErrStepEstimationUnavailable is returned when the
+	// steps of a transaction can not be estimated, because
+	// the ICON Node does not expose its debug API.
+	ErrStepEstimationUnavailable = &types.Error{
+		Code:    28, //nolint
+		Message: "Step estimation unavailable",
+	}
+
+	// ErrUnsupportedCurrency is returned when a balance
+	// is requested in a currency which is neither ICX nor
+	// an IRC2 token with its contract in metadata.
+	ErrUnsupportedCurrency = &types.Error{
+		Code:    29, //nolint
+		Message: "Unsupported currency",
+	}
+
+	// ErrReceiptMismatch is returned when the receipts
+	// returned by ICON Node do not pair up with the
+	// transactions of the block by hash.
+	ErrReceiptMismatch = &types.Error{
+		Code:    30, //nolint
+		Message: "Receipts do not match transactions",
+	}
+
+	// ErrNodeHTTPUnavailable is returned when ICON Node
+	// answers with an HTTP server error or too many
+	// requests instead of a JSON-RPC response.
+	ErrNodeHTTPUnavailable = &types.Error{
+		Code:      31, //nolint
+		Message:   "ICON Node HTTP error, try again later",
+		Retriable: true,
+	}
 )
 
 // wrapErr adds details to the types.Error provided. We use a function
 // to do this so that we don't accidentially overrwrite the standard
-// errors.
+// errors. A transient node failure is reported as the retriable node
+// error it is instead of rErr, so that the result is always retriable
+// as advertised for its code.
 func wrapErr(rErr *types.Error, err error) *types.Error {
+	if !rErr.Retriable && client_v1.IsRetriable(err) {
+		rErr = transientErr(err)
+	}
 	newErr := &types.Error{
 		Code:      rErr.Code,
 		Message:   rErr.Message,
@@ -121,3 +295,55 @@ func wrapErr(rErr *types.Error, err error) *types.Error {
 
 	return newErr
 }
+
+// nodeErr converts a failed ICON Node request into the matching error.
+// invalid is returned when the node rejects the request parameters or
+// cannot find what they refer to; older nodes report unknown hashes as
+// invalid params.
+func nodeErr(invalid *types.Error, err error) *types.Error {
+	return wrapErr(nodeErrKind(invalid, err), err)
+}
+
+// transientErr returns the retriable error matching a transient node
+// failure.
+func transientErr(err error) *types.Error {
+	if rErr := nodeErrKind(ErrNodeUnavailable, err); rErr.Retriable {
+		return rErr
+	}
+	return ErrNodeUnavailable
+}
+
+func nodeErrKind(invalid *types.Error, err error) *types.Error {
+	switch {
+	case errors.Is(err, client_v1.ErrUnstableHead):
+		return ErrUnstableHead
+	case errors.Is(err, client_v1.ErrReceiptMismatch):
+		return ErrReceiptMismatch
+	case errors.Is(err, client_v1.ErrInvalidParams),
+		errors.Is(err, client_v1.ErrNotFound):
+		return invalid
+	case errors.Is(err, client_v1.ErrPending):
+		return ErrTransactionPending
+	case errors.Is(err, client_v1.ErrExecuting):
+		return ErrTransactionExecuting
+	case errors.Is(err, client_v1.ErrTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		return ErrNodeTimeout
+	case errors.Is(err, client_v1.ErrServer):
+		return ErrNodeInternal
+	case errors.Is(err, client_v1.ErrScore):
+		return ErrScoreFailure
+	case errors.Is(err, client_v1.ErrMethodNotFound):
+		return ErrMethodNotSupported
+	case errors.Is(err, client_v1.ErrHTTP):
+		if client_v1.IsRetriable(err) {
+			return ErrNodeHTTPUnavailable
+		}
+		return ErrNodeHTTP
+	case errors.Is(err, client_v1.ErrUnavailable),
+		errors.Is(err, context.Canceled):
+		return ErrNodeUnavailable
+	default:
+		return ErrInvalidNodeResponse
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/server/jsonrpc"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+)
+
+func TestWrapErrKeepsAdvertisedRetriable(t *testing.T) {
+	advertised := map[int32]bool{}
+	for _, e := range Errors {
+		advertised[e.Code] = e.Retriable
+	}
+
+	causes := []error{
+		nil,
+		errors.New("invalid"),
+		&client_v1.NodeError{Kind: client_v1.ErrServer, Method: "icx_getBlock", Err: &jsonrpc.Error{Code: jsonrpc.ErrorCodeServer}},
+		&client_v1.NodeError{Kind: client_v1.ErrTimeout, Method: "icx_getBlock", Err: &jsonrpc.Error{Code: jsonrpc.ErrorCodeTimeout}},
+		&client_v1.NodeError{Kind: client_v1.ErrInvalidParams, Method: "icx_getBlock", Err: &jsonrpc.Error{Code: jsonrpc.ErrorCodeInvalidParams}},
+		&client_v1.NodeError{Kind: client_v1.ErrHTTP, Method: "icx_getBlock", Err: &client_v1.HttpError{StatusCode: 503}},
+		&client_v1.NodeError{Kind: client_v1.ErrHTTP, Method: "icx_getBlock", Err: &client_v1.HttpError{StatusCode: 404}},
+		&client_v1.NodeError{Kind: client_v1.ErrUnavailable, Method: "icx_getBlock", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}},
+	}
+	for _, rErr := range Errors {
+		for _, cause := range causes {
+			for _, wrapped := range []*types.Error{wrapErr(rErr, cause), nodeErr(rErr, cause)} {
+				retriable, ok := advertised[wrapped.Code]
+				if !ok {
+					t.Fatalf("error %d is not advertised", wrapped.Code)
+				}
+				if wrapped.Retriable != retriable {
+					t.Errorf("error %d for %v is retriable %v, advertised %v",
+						wrapped.Code, cause, wrapped.Retriable, retriable)
+				}
+			}
+		}
+	}
+
+	transient := causes[2]
+	if e := wrapErr(ErrInvalidAddress, transient); e.Code != ErrNodeInternal.Code {
+		t.Fatalf("transient failure reported as %s", types.PrettyPrintStruct(e))
+	}
+	if e := nodeErr(ErrBlockNotFound, causes[5]); e.Code != ErrNodeHTTPUnavailable.Code {
+		t.Fatalf("http 503 reported as %s", types.PrettyPrintStruct(e))
+	}
+	if e := nodeErr(ErrBlockNotFound, causes[6]); e.Code != ErrNodeHTTP.Code {
+		t.Fatalf("http 404 reported as %s", types.PrettyPrintStruct(e))
+	}
+	unreachable := causes[7]
+	if e := wrapErr(ErrUnclearIntent, unreachable); e.Code != ErrNodeUnavailable.Code {
+		t.Fatalf("unreachable node reported as %s", types.PrettyPrintStruct(e))
+	}
+}
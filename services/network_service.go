@@ -58,26 +58,21 @@ func (s *NetworkAPIService) NetworkStatus(
 		return nil, wrapErr(ErrUnavailableOffline, nil)
 	}
 
-	gh := int64(0)
-	params := &types.PartialBlockIdentifier{
-		Index: &gh,
-	}
-	genesisBlock, err := s.client.GetBlock(params)
+	genesis, err := s.client.GetGenesisBlockIdentifier(ctx)
 	if err != nil {
-		return nil, wrapErr(ErrWrongBlockHash, err)
+		return nil, nodeErr(ErrBlockNotFound, err)
 	}
 
-	params = &types.PartialBlockIdentifier{}
-	lastBlock, err := s.client.GetBlock(params)
+	current, timestamp, err := s.client.GetLastBlockHeader(ctx)
 	if err != nil {
-		return nil, wrapErr(ErrWrongBlockHash, err)
+		return nil, nodeErr(ErrBlockNotFound, err)
 	}
 
-	peers, err := s.client.GetPeer()
+	peers, _ := s.client.GetCachedPeer(ctx)
 	return &types.NetworkStatusResponse{
-		CurrentBlockIdentifier: lastBlock.BlockIdentifier,
-		CurrentBlockTimestamp:  lastBlock.Timestamp,
-		GenesisBlockIdentifier: genesisBlock.BlockIdentifier,
+		CurrentBlockIdentifier: current,
+		CurrentBlockTimestamp:  timestamp,
+		GenesisBlockIdentifier: genesis,
 		SyncStatus:             nil,
 		Peers:                  peers,
 	}, nil
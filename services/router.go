@@ -55,10 +55,10 @@ func NewBlockchainRouter(
 		asserter,
 	)
 
-	return server.NewRouter(
+	return withCurrencies(server.NewRouter(
 		networkAPIController,
 		accountAPIController,
 		blockAPIController,
 		constructionAPIController,
-	)
+	))
 }
@@ -0,0 +1,288 @@
+// Copyright 2020 ICON Foundation, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/asserter"
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/icon-project/goloop/common"
+	"github.com/icon-project/goloop/common/crypto"
+	"github.com/leeheonseung/rosetta-icon/configuration"
+	"github.com/leeheonseung/rosetta-icon/icon"
+	"github.com/leeheonseung/rosetta-icon/icon/client_v1"
+	"github.com/leeheonseung/rosetta-icon/icon/emulator"
+)
+
+var testNetwork = &types.NetworkIdentifier{
+	Blockchain: client_v1.Blockchain,
+	Network:    client_v1.DevelopNetwork,
+}
+
+// call posts req to path of srv and decodes the response into resp. It
+// fails the test unless the request succeeds.
+func call(t *testing.T, srv *httptest.Server, path string, req interface{}, resp interface{}) {
+	t.Helper()
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		var e types.Error
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		t.Fatalf("%s: status %d: %s", path, r.StatusCode, types.PrettyPrintStruct(e))
+	}
+	if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
+
+// callError posts req to path of srv and returns the error response. It
+// fails the test if the request succeeds.
+func callError(t *testing.T, srv *httptest.Server, path string, req interface{}) *types.Error {
+	t.Helper()
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusOK {
+		t.Fatalf("%s: request succeeded", path)
+	}
+	e := new(types.Error)
+	if err := json.NewDecoder(r.Body).Decode(e); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return e
+}
+
+func TestRouterTransfer(t *testing.T) {
+	priv, pub := crypto.GenerateKeyPair()
+	sender := common.NewAccountAddressFromPublicKey(pub).String()
+	receiver := "hx0000000000000000000000000000000000000001"
+	initial, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	node := emulator.NewServer(80, map[string]*big.Int{sender: initial}, []string{
+		"hx1111111111111111111111111111111111111111",
+	})
+	defer node.Close()
+	node.AutoProduce = false
+	node.Produce()
+
+	cfg := &configuration.Configuration{Mode: configuration.Online, Network: testNetwork}
+	client := icon.NewClient([]string{node.URL()}, client_v1.ICXCurrency)
+	a, err := asserter.NewServer(
+		client_v1.OperationTypes,
+		client_v1.HistoricalBalanceSupported,
+		[]*types.NetworkIdentifier{testNetwork},
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewBlockchainRouter(cfg, client, a))
+	defer srv.Close()
+
+	ops := []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{Index: 0},
+			Type:                client_v1.TransferOpType,
+			Account:             &types.AccountIdentifier{Address: sender},
+			Amount:              &types.Amount{Value: "-1000", Currency: client_v1.ICXCurrency},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{Index: 1},
+			Type:                client_v1.TransferOpType,
+			Account:             &types.AccountIdentifier{Address: receiver},
+			Amount:              &types.Amount{Value: "1000", Currency: client_v1.ICXCurrency},
+		},
+	}
+
+	var preprocess types.ConstructionPreprocessResponse
+	call(t, srv, "/construction/preprocess", &types.ConstructionPreprocessRequest{
+		NetworkIdentifier: testNetwork,
+		Operations:        ops,
+	}, &preprocess)
+
+	var metadata types.ConstructionMetadataResponse
+	call(t, srv, "/construction/metadata", &types.ConstructionMetadataRequest{
+		NetworkIdentifier: testNetwork,
+		Options:           preprocess.Options,
+	}, &metadata)
+
+	var payloads types.ConstructionPayloadsResponse
+	call(t, srv, "/construction/payloads", &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: testNetwork,
+		Operations:        ops,
+		Metadata:          metadata.Metadata,
+	}, &payloads)
+	if len(payloads.Payloads) != 1 {
+		t.Fatalf("%d payloads", len(payloads.Payloads))
+	}
+
+	sig, err := crypto.NewSignature(payloads.Payloads[0].Bytes, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigBytes, err := sig.SerializeRSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var combined types.ConstructionCombineResponse
+	call(t, srv, "/construction/combine", &types.ConstructionCombineRequest{
+		NetworkIdentifier:   testNetwork,
+		UnsignedTransaction: payloads.UnsignedTransaction,
+		Signatures: []*types.Signature{{
+			SigningPayload: payloads.Payloads[0],
+			PublicKey: &types.PublicKey{
+				Bytes:     pub.SerializeCompressed(),
+				CurveType: types.Secp256k1,
+			},
+			SignatureType: types.EcdsaRecovery,
+			Bytes:         sigBytes,
+		}},
+	}, &combined)
+
+	var submitted types.TransactionIdentifierResponse
+	call(t, srv, "/construction/submit", &types.ConstructionSubmitRequest{
+		NetworkIdentifier: testNetwork,
+		SignedTransaction: combined.SignedTransaction,
+	}, &submitted)
+	height := node.Produce()
+
+	var block types.BlockResponse
+	call(t, srv, "/block", &types.BlockRequest{
+		NetworkIdentifier: testNetwork,
+		BlockIdentifier:   &types.PartialBlockIdentifier{Index: &height},
+	}, &block)
+
+	var tx *types.Transaction
+	for _, btx := range block.Block.Transactions {
+		if btx.TransactionIdentifier.Hash == submitted.TransactionIdentifier.Hash {
+			tx = btx
+		}
+	}
+	if tx == nil {
+		t.Fatalf("transaction %s not in block %d", submitted.TransactionIdentifier.Hash, height)
+	}
+
+	// The sender pays the transfer and the fee.
+	spent := new(big.Int)
+	for _, op := range tx.Operations {
+		if op.Account.Address != sender {
+			continue
+		}
+		value, ok := new(big.Int).SetString(op.Amount.Value, 10)
+		if !ok {
+			t.Fatalf("invalid amount %s", op.Amount.Value)
+		}
+		spent.Add(spent, value)
+	}
+	if spent.Cmp(big.NewInt(-1000)) >= 0 {
+		t.Fatalf("sender spent %s, without a fee", spent)
+	}
+
+	balances := map[string]*big.Int{
+		sender:   new(big.Int).Add(initial, spent),
+		receiver: big.NewInt(1000),
+	}
+	for address, want := range balances {
+		var balance types.AccountBalanceResponse
+		call(t, srv, "/account/balance", &types.AccountBalanceRequest{
+			NetworkIdentifier: testNetwork,
+			AccountIdentifier: &types.AccountIdentifier{Address: address},
+			BlockIdentifier: &types.PartialBlockIdentifier{
+				Index: &block.Block.BlockIdentifier.Index,
+				Hash:  &block.Block.BlockIdentifier.Hash,
+			},
+		}, &balance)
+		if balance.BlockIdentifier.Hash != block.Block.BlockIdentifier.Hash {
+			t.Errorf("balance of %s at block %+v", address, balance.BlockIdentifier)
+		}
+		if len(balance.Balances) != 1 || balance.Balances[0].Value != want.String() {
+			t.Errorf("balance of %s is %s, want %s", address, types.PrettyPrintStruct(balance.Balances), want)
+		}
+	}
+}
+
+func TestRouterBalanceAtUnknownBlock(t *testing.T) {
+	address := "hx0000000000000000000000000000000000000001"
+	node := emulator.NewServer(80, map[string]*big.Int{address: big.NewInt(1000)}, nil)
+	defer node.Close()
+	node.AutoProduce = false
+	node.Produce()
+
+	cfg := &configuration.Configuration{Mode: configuration.Online, Network: testNetwork}
+	client := icon.NewClient([]string{node.URL()}, client_v1.ICXCurrency)
+	a, err := asserter.NewServer(
+		client_v1.OperationTypes,
+		client_v1.HistoricalBalanceSupported,
+		[]*types.NetworkIdentifier{testNetwork},
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewBlockchainRouter(cfg, client, a))
+	defer srv.Close()
+
+	beyond := int64(5)
+	wrongHash := "0x" + strings.Repeat("ab", 32)
+	zero := int64(0)
+	for _, id := range []*types.PartialBlockIdentifier{
+		{Index: &beyond},
+		{Hash: &wrongHash},
+		{Index: &zero, Hash: &wrongHash},
+	} {
+		e := callError(t, srv, "/account/balance", &types.AccountBalanceRequest{
+			NetworkIdentifier: testNetwork,
+			AccountIdentifier: &types.AccountIdentifier{Address: address},
+			BlockIdentifier:   id,
+		})
+		if e.Code != ErrBlockNotFound.Code {
+			t.Errorf("balance at %s: %s", types.PrettyPrintStruct(id), types.PrettyPrintStruct(e))
+		}
+	}
+
+	// Resolving the block of a balance does not fetch and cache the block.
+	var balance types.AccountBalanceResponse
+	call(t, srv, "/account/balance", &types.AccountBalanceRequest{
+		NetworkIdentifier: testNetwork,
+		AccountIdentifier: &types.AccountIdentifier{Address: address},
+		BlockIdentifier:   &types.PartialBlockIdentifier{Index: &zero},
+	}, &balance)
+	if balance.BlockIdentifier.Index != 0 || balance.Balances[0].Value != "1000" {
+		t.Fatalf("balance %s", types.PrettyPrintStruct(balance))
+	}
+	if stats := client.BlockCacheStats(); stats.Entries != 0 {
+		t.Fatalf("block cache %s", stats)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/coinbase/rosetta-sdk-go/types"
@@ -18,7 +19,7 @@ func main() {
 		return
 	}
 
-	rpcClient := icon.NewClient(cfg.URL, client_v1.ICXCurrency)
+	rpcClient := icon.NewClient(cfg.URLs, client_v1.ICXCurrency)
 
 	//sampleGetBlock(rpcClient)
 	//sampleGetPeer(rpcClient)
@@ -33,7 +34,7 @@ func sampleGetBlock(client *icon.Client) {
 		Index: &index,
 	}
 
-	block, err := client.GetBlock(params)
+	block, err := client.GetBlock(context.Background(), params)
 	err = JsonPrettyPrintln(os.Stdout, block)
 	fmt.Print(err)
 }
@@ -45,13 +46,13 @@ func sampleGetTransaction(client *icon.Client) {
 		Hash: "0x2c89b69a75ce737ac61b76a6a86ffa233362ae7b05eabd54d067737e282b75c0",
 	}
 
-	tx, err := client.GetTransaction(params)
+	tx, err := client.GetTransaction(context.Background(), params)
 	err = JsonPrettyPrintln(os.Stdout, tx)
 	fmt.Print(err)
 }
 
 func sampleGetPeer(client *icon.Client) {
-	status, err := client.GetPeer()
+	status, err := client.GetPeer(context.Background())
 	err = JsonPrettyPrintln(os.Stdout, status)
 	fmt.Print(err)
 }